@@ -0,0 +1,3 @@
+module github.com/benjamin-rood/geode
+
+go 1.24
@@ -0,0 +1,138 @@
+package kdtree
+
+import "math"
+
+// MonoidOf summarises sets of PointOfs for RangeAggregate: each PointOf is
+// lifted to a summary of its own, and summaries are combined pairwise, in the
+// order RangeQuery would return the PointOfs, into that of the whole set.
+// Combine must be associative, with Identity, the summary of no PointOfs at
+// all, as its identity on either side.
+type MonoidOf[C Coordinate, T any] struct {
+	Identity interface{}
+	Lift     func(d *PointOf[C, T]) interface{}
+	Combine  func(a, b interface{}) interface{}
+}
+
+// Monoid summarises sets of Datapoints for RangeAggregate.
+type Monoid = MonoidOf[float64, interface{}]
+
+// SumOf returns the Monoid summing value over the Datapoints, as a float64.
+func SumOf[C Coordinate, T any](value func(d *PointOf[C, T]) float64) *MonoidOf[C, T] {
+	return &MonoidOf[C, T]{
+		Identity: 0.0,
+		Lift:     func(d *PointOf[C, T]) interface{} { return value(d) },
+		Combine:  func(a, b interface{}) interface{} { return a.(float64) + b.(float64) },
+	}
+}
+
+// MinOf returns the Monoid taking the least value over the Datapoints, as a
+// float64, which is +Inf for none.
+func MinOf[C Coordinate, T any](value func(d *PointOf[C, T]) float64) *MonoidOf[C, T] {
+	return &MonoidOf[C, T]{
+		Identity: math.Inf(1),
+		Lift:     func(d *PointOf[C, T]) interface{} { return value(d) },
+		Combine:  func(a, b interface{}) interface{} { return math.Min(a.(float64), b.(float64)) },
+	}
+}
+
+// MaxOf returns the Monoid taking the greatest value over the Datapoints, as a
+// float64, which is -Inf for none.
+func MaxOf[C Coordinate, T any](value func(d *PointOf[C, T]) float64) *MonoidOf[C, T] {
+	return &MonoidOf[C, T]{
+		Identity: math.Inf(-1),
+		Lift:     func(d *PointOf[C, T]) interface{} { return value(d) },
+		Combine:  func(a, b interface{}) interface{} { return math.Max(a.(float64), b.(float64)) },
+	}
+}
+
+// RangeCount returns the number of live Datapoints RangeQuery would return for
+// bounds, without gathering them: a branch wholly within bounds is counted in
+// constant time, so only those straddling their sides are looked into.
+func RangeCount[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range) int {
+	if branch.size() == 0 {
+		return 0
+	}
+	switch rangeOverlap(branch.box, bounds) {
+	case overlapNone:
+		return 0
+	case overlapAll:
+		return branch.count
+	}
+
+	if !branch.isLeaf() {
+		return RangeCount(branch.left, bounds) + RangeCount(branch.right, bounds)
+	}
+	var count int
+	for i, d := range branch.Datapoints {
+		if d != nil && !branch.isTombstoned(i) && inRanges(d, bounds) {
+			count++
+		}
+	}
+	return count
+}
+
+// RangeAggregate returns the summary under m of the live Datapoints RangeQuery
+// would return for bounds, without gathering them. If m is one of the Summaries
+// the tree was built with, a branch wholly within bounds is summarised in constant
+// time, as for RangeCount; otherwise every Datapoint within bounds is lifted in turn.
+func RangeAggregate[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range, m *MonoidOf[C, T]) interface{} {
+	cached := -1
+	for i, s := range branch.options().Summaries {
+		if s == m {
+			cached = i
+			break
+		}
+	}
+	return rangeAggregate(branch, bounds, m, cached)
+}
+
+func rangeAggregate[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range, m *MonoidOf[C, T], cached int) interface{} {
+	if branch.size() == 0 {
+		return m.Identity
+	}
+	overlap := rangeOverlap(branch.box, bounds)
+	switch {
+	case overlap == overlapNone:
+		return m.Identity
+	case overlap == overlapAll && cached >= 0:
+		return branch.summaries[cached]
+	}
+
+	if !branch.isLeaf() {
+		return m.Combine(rangeAggregate(branch.left, bounds, m, cached), rangeAggregate(branch.right, bounds, m, cached))
+	}
+	summary := m.Identity
+	for i, d := range branch.Datapoints {
+		if d != nil && !branch.isTombstoned(i) && inRanges(d, bounds) {
+			summary = m.Combine(summary, m.Lift(d))
+		}
+	}
+	return summary
+}
+
+// summarise recomputes the summary of the branch under each of the Monoids it
+// was built with, from the live Datapoints of a leaf or from the summaries of
+// the children of an internal branch. The summaries are replaced rather than
+// updated in place, as earlier copies of the branch may still share them.
+func (branch *TreeOf[C, T]) summarise() {
+	monoids := branch.options().Summaries
+	if len(monoids) == 0 {
+		branch.summaries = nil
+		return
+	}
+	summaries := make([]interface{}, len(monoids), len(monoids))
+	for i, m := range monoids {
+		if !branch.isLeaf() {
+			summaries[i] = m.Combine(branch.left.summaries[i], branch.right.summaries[i])
+			continue
+		}
+		summary := m.Identity
+		for j, d := range branch.Datapoints {
+			if d != nil && !branch.isTombstoned(j) {
+				summary = m.Combine(summary, m.Lift(d))
+			}
+		}
+		summaries[i] = summary
+	}
+	branch.summaries = summaries
+}
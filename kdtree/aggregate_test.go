@@ -0,0 +1,111 @@
+package kdtree
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// weight is the value the tests aggregate, held as each Datapoint's Data.
+func weight(d *Datapoint) float64 {
+	return d.data.(float64)
+}
+
+// sequence records the order in which Datapoints are combined, and is not commutative.
+var sequence = &Monoid{
+	Identity: "",
+	Lift:     func(d *Datapoint) interface{} { return fmt.Sprint(d.set) },
+	Combine:  func(a, b interface{}) interface{} { return a.(string) + b.(string) },
+}
+
+func Test_RangeAggregate_Matches_Brute_Force(t *testing.T) {
+	r := rand.New(rand.NewSource(19))
+	var ds Datapoints
+	for i := 0; i < 400; i++ {
+		ds = append(ds, &Datapoint{float64(r.Intn(100)), []float64{float64(r.Intn(10)), float64(r.Intn(10)), float64(r.Intn(10))}})
+	}
+	sum, min, max := SumOf(weight), MinOf(weight), MaxOf(weight)
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, LeafSize: 4, Summaries: []*Monoid{sum, min, max, sequence}})
+	uncached := Build(ds, 0, Median)
+
+	check := func(live Datapoints) {
+		for i := 0; i < 200; i++ {
+			bounds := []Range{randomRange(r), randomRange(r), randomRange(r)}
+			inside := bruteForceRange(live, bounds)
+			wantSum, wantMin, wantMax := 0.0, math.Inf(1), math.Inf(-1)
+			for _, d := range inside {
+				wantSum += weight(d)
+				wantMin, wantMax = math.Min(wantMin, weight(d)), math.Max(wantMax, weight(d))
+			}
+
+			for _, tr := range []*Branch{tree, uncached} {
+				if got := RangeCount(tr, bounds); got != len(inside) {
+					t.Error(bounds, ` count want: `, len(inside), `
+		got: `, got)
+				}
+				if got := RangeAggregate(tr, bounds, sum); got != wantSum {
+					t.Error(bounds, ` sum want: `, wantSum, `
+		got: `, got)
+				}
+				if got := RangeAggregate(tr, bounds, min); got != wantMin {
+					t.Error(bounds, ` min want: `, wantMin, `
+		got: `, got)
+				}
+				if got := RangeAggregate(tr, bounds, max); got != wantMax {
+					t.Error(bounds, ` max want: `, wantMax, `
+		got: `, got)
+				}
+			}
+			var want string
+			for _, d := range RangeQuery(tree, bounds) {
+				want += fmt.Sprint(d.set)
+			}
+			if got := RangeAggregate(tree, bounds, sequence); got != want {
+				t.Error(bounds, ` order want: `, want, `
+		got: `, got)
+			}
+		}
+	}
+	check(ds)
+
+	// the cached summaries follow Insert and Delete, and survive rebuilds
+	live := append(Datapoints{}, ds[150:]...)
+	for _, d := range ds[:150] {
+		tree.Delete(d)
+		uncached.Delete(d)
+	}
+	for i := 0; i < 150; i++ {
+		d := &Datapoint{float64(r.Intn(100)), []float64{float64(r.Intn(10)), float64(r.Intn(10)), float64(r.Intn(10))}}
+		tree.Insert(d)
+		uncached.Insert(d)
+		live = append(live, d)
+	}
+	check(live)
+}
+
+func Test_RangeAggregate_Snapshot_Summaries_Are_Immutable(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 200; i++ {
+		ds = append(ds, &Datapoint{float64(i), []float64{float64(i % 20), float64(i / 20)}})
+	}
+	sum := SumOf(weight)
+	ix := NewIndex(BuildWith(ds, 0, BuildOptions{Summaries: []*Monoid{sum}}))
+	before := ix.Snapshot()
+
+	for _, d := range ds[:100] {
+		ix.Delete(d)
+	}
+	if got := RangeAggregate(before, nil, sum); got != 199.0*200/2 {
+		t.Error(`want: `, 199.0*200/2, `
+		got: `, got)
+	}
+	if got := RangeAggregate(ix.Snapshot(), nil, sum); got != (199.0*200-99.0*100)/2 {
+		t.Error(`want: `, (199.0*200-99.0*100)/2, `
+		got: `, got)
+	}
+	if got := RangeCount(ix.Snapshot(), []Range{Unbounded(), NewRange(5, 10, false, true)}); got != 80 {
+		t.Error(`want: 80
+		got: `, got)
+	}
+}
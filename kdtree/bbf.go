@@ -0,0 +1,110 @@
+package kdtree
+
+import "container/heap"
+
+// bin is a subtree waiting to be searched, with the target as seen in the frame
+// of the tree it belongs to, and the least distance from the target any of its
+// Datapoints could be.
+type bin[C Coordinate, T any] struct {
+	branch *TreeOf[C, T]
+	target *PointOf[C, T]
+	bound  float64
+}
+
+// binHeap is a min-heap on bound, so the root is always the most promising bin.
+type binHeap[C Coordinate, T any] []bin[C, T]
+
+func (h binHeap[C, T]) Len() int            { return len(h) }
+func (h binHeap[C, T]) Less(i, j int) bool  { return h[i].bound < h[j].bound }
+func (h binHeap[C, T]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *binHeap[C, T]) Push(x interface{}) { *h = append(*h, x.(bin[C, T])) }
+func (h *binHeap[C, T]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// BBF returns the nearest-neighbouring Datapoint to target found in the k-d tree
+// branch by a best-bin-first search under metric (Euclidean if nil), along with
+// the number of nodes examined, as BBFKNN does for k of 1.
+func BBF[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], checks int, metric MetricOf[C]) (*PointOf[C, T], int) {
+	nearest, examined := BBFKNN(branch, target, 1, checks, metric)
+	if len(nearest) == 0 {
+		return nil, examined
+	}
+	return nearest[0], examined
+}
+
+// BBFKNN returns the k nearest-neighbouring Datapoints to target found in the
+// k-d tree branch by a best-bin-first search under metric (Euclidean if nil),
+// ordered by ascending distance, along with the number of nodes examined.
+// Rather than backtracking up the tree, as KNN does, the search always resumes
+// from whichever subtree passed over so far is nearest to target, and gives up
+// once it has checked the given number of leaves, returning the best candidates
+// found by then. In many dimensions, where KNN visits nearly every node, a few
+// hundred checks usually find most of the true nearest neighbours.
+// With checks of 0 or less the search runs to the end, and is exact.
+func BBFKNN[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], k, checks int, metric MetricOf[C]) (PointsOf[C, T], int) {
+	if branch == nil || k <= 0 {
+		return nil, 0
+	}
+	if metric == nil {
+		metric = EuclideanOf[C]()
+	}
+	s := bbfSearch[C, T]{k: k, checks: checks, metric: metric, found: make(neighbourHeap[C, T], 0, k)}
+	s.push(branch, target)
+	s.run()
+	return s.found.sorted(), s.examined
+}
+
+type bbfSearch[C Coordinate, T any] struct {
+	k        int
+	checks   int // leaves left to check, or unlimited if 0 or less at the start
+	metric   MetricOf[C]
+	found    neighbourHeap[C, T]
+	bins     binHeap[C, T]
+	examined int
+	seen     func(d *PointOf[C, T]) bool // when searching several trees, reports whether d was already offered, marking it so
+}
+
+// push queues the subtree under branch to be searched for target, unless it is empty.
+func (s *bbfSearch[C, T]) push(branch *TreeOf[C, T], target *PointOf[C, T]) {
+	if branch.size() == 0 {
+		return
+	}
+	heap.Push(&s.bins, bin[C, T]{branch, target, branch.box.lowerBound(target.set, s.metric)})
+}
+
+// run searches the queued bins, nearest first, until the leaf checks run out or
+// no bin left could hold a nearer Datapoint than those found.
+func (s *bbfSearch[C, T]) run() {
+	unlimited := s.checks <= 0
+	for len(s.bins) > 0 && (unlimited || s.checks > 0) {
+		next := heap.Pop(&s.bins).(bin[C, T])
+		if worst, full := s.found.bound(s.k); full && next.bound > worst {
+			return
+		}
+
+		// descend to the leaf nearest target, queueing each subtree passed over
+		branch := next.branch
+		for !branch.isLeaf() {
+			s.examined++
+			near, far := branch.split(next.target)
+			if near.size() == 0 {
+				near, far = far, near
+			}
+			s.push(far, next.target)
+			branch = near
+		}
+		s.examined++
+		branch.measure(next.target, s.metric, func(d *PointOf[C, T], dist float64) {
+			if s.seen != nil && s.seen(d) {
+				return
+			}
+			s.found.offer(d, dist, s.k)
+		})
+		s.checks--
+	}
+}
@@ -0,0 +1,105 @@
+package kdtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_BBFKNN_Unlimited_Is_Exact(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -50, 50))
+	}
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, LeafSize: 4})
+
+	for i := 0; i < 50; i++ {
+		target := RandomDatapointInRange(3, -60, 60)
+		for _, k := range []int{1, 5, 600} {
+			want := bruteForceKNN(ds, target, k)
+			got, examined := BBFKNN(tree, target, k, 0, nil)
+			if !sameDistances(target, got, want) {
+				t.Error(`k = `, k, ` want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+			}
+			if examined < 1 || examined > countNodes(tree) {
+				t.Error(`examined: `, examined, ` of `, countNodes(tree), ` nodes`)
+			}
+		}
+		nearest, _ := BBF(tree, target, 0, nil)
+		if want := bruteForceKNN(ds, target, 1); DistanceSq(target, nearest) != DistanceSq(target, want[0]) {
+			t.Error(`want: `, want[0], `
+		got: `, nearest)
+		}
+	}
+}
+
+func Test_BBFKNN_Budget_In_Many_Dimensions(t *testing.T) {
+	r := rand.New(rand.NewSource(22))
+	random := func() *Datapoint {
+		set := make([]float64, 64)
+		for axis := range set {
+			set[axis] = r.Float64()
+		}
+		return &Datapoint{nil, set}
+	}
+	var ds Datapoints
+	for i := 0; i < 2000; i++ {
+		ds = append(ds, random())
+	}
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, Axis: MaxVariance, LeafSize: 8})
+	nodes := countNodes(tree)
+
+	const k, queries = 5, 20
+	recalls, examinedTotals := map[int]int{}, map[int]int{}
+	for i := 0; i < queries; i++ {
+		target := random()
+		want := map[*Datapoint]bool{}
+		for _, d := range bruteForceKNN(ds, target, k) {
+			want[d] = true
+		}
+		for _, checks := range []int{10, 50} {
+			got, examined := BBFKNN(tree, target, k, checks, nil)
+			if len(got) != k {
+				t.Fatal(`want: `, k, ` candidates
+		got: `, len(got))
+			}
+			for j := 1; j < len(got); j++ {
+				if DistanceSq(target, got[j]) < DistanceSq(target, got[j-1]) {
+					t.Error(`candidates not ordered nearest first`)
+				}
+			}
+			for _, d := range got {
+				if want[d] {
+					recalls[checks]++
+				}
+			}
+			examinedTotals[checks] += examined
+		}
+	}
+
+	if examinedTotals[10] >= examinedTotals[50] || examinedTotals[50] >= nodes*queries/2 {
+		t.Error(`examined `, examinedTotals[10], ` and `, examinedTotals[50], ` nodes for 10 and 50 checks, of `, nodes*queries)
+	}
+	if recalls[50] <= recalls[10] || recalls[50] < k*queries/3 {
+		t.Error(`found `, recalls[10], ` and `, recalls[50], ` of the `, k*queries, ` nearest neighbours for 10 and 50 checks`)
+	}
+}
+
+func Test_BBFKNN_Edge_Cases(t *testing.T) {
+	if got, examined := BBFKNN(nil, &Datapoint{nil, []float64{0}}, 3, 10, nil); got != nil || examined != 0 {
+		t.Error(`want: nothing from a nil tree
+		got: `, got, examined)
+	}
+	tree := Build(append(Datapoints{}, dps1...), 0, Median)
+	if got, _ := BBFKNN(tree, dps1[0], 0, 10, nil); got != nil {
+		t.Error(`want: nothing for k of 0
+		got: `, got.PointsSetString())
+	}
+	for _, d := range dps1 {
+		tree.Delete(d)
+	}
+	if got, _ := BBF(tree, dps1[0], 10, nil); got != nil {
+		t.Error(`want: nil from an emptied tree
+		got: `, got)
+	}
+}
@@ -0,0 +1,612 @@
+package kdtree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+)
+
+// The binary format written by WriteTo is, in little-endian order:
+//
+//	magic         8 bytes  "GEODEKDT"
+//	version       uint16   format version the tree was written in
+//	minReader     uint16   earliest format version able to read it
+//	headerLen     uint32   bytes of header fields which follow
+//	dimensionality uint32
+//	pivotRule     uint8    0 unknown, 1 LazyAverage, 2 Median, 3 Mean,
+//	                       4 QuickMedian, 5 SampledMedian, 6 SlidingMidpoint
+//	leafSize      uint32
+//	depth         int32    depth of the root branch
+//	nodes, points uint64   number of branches and of live Datapoints
+//	maxDepth      int32    since version 2; 0 for no limit
+//	axisRule      uint8    since version 2; 0 unknown, 1 Cycle, 2 MaxSpread, 3 MaxVariance
+//	coordType     uint8    since version 3; 0 float64, 1 float32, 2 int8, 3 int16,
+//	                       4 int32, 5 uint8, 6 uint16, 7 uint32
+//
+// followed by the branches in pre-order. An internal branch is a 0 byte, its
+// float64 pivot and, since version 2, the uvarint axis it splits on; a leaf is
+// a 1 byte, a uvarint count and that many Datapoints, each as its values
+// followed by a uvarint length and the JSON of its data payload (length 0 for
+// nil). Tombstoned Datapoints are not written. Values are written as coordType,
+// in as many bytes as it takes; before version 3 they are all float64.
+//
+// Readers refuse more than maxBinaryDimensionality axes, and branches nested more
+// than maxBinaryNesting deep below the root, so WriteTo refuses to write either.
+//
+// A later version may append fields to the header, which earlier readers skip
+// over using headerLen; it only raises minReader when earlier readers can no
+// longer make sense of what follows.
+const (
+	binaryMagic       = "GEODEKDT"
+	binaryVersion     = 3
+	binaryMinReader   = 3
+	binaryHeaderLen   = binaryHeaderLenV2 + 1
+	binaryHeaderLenV2 = binaryHeaderLenV1 + 4 + 1
+	binaryHeaderLenV1 = 4 + 1 + 4 + 4 + 8 + 8
+
+	internalNode = 0
+	leafNode     = 1
+
+	maxBinaryDimensionality = 1 << 16
+	maxBinaryNesting        = 1 << 16
+)
+
+// pivotRulesOf and axisRulesOf map the pivotRule and axisRule header fields to
+// the pre-defined PivotFuncOfs and AxisFuncOfs.
+func pivotRulesOf[C Coordinate, T any]() []PivotFuncOf[C, T] {
+	return []PivotFuncOf[C, T]{nil, LazyAverageOf[C, T](), MedianOf[C, T](), MeanOf[C, T](),
+		QuickMedianOf[C, T](), SampledMedianOf[C, T](), SlidingMidpointOf[C, T]()}
+}
+
+func axisRulesOf[C Coordinate, T any]() []AxisFuncOf[C, T] {
+	return []AxisFuncOf[C, T]{nil, CycleOf[C, T](), MaxSpreadOf[C, T](), MaxVarianceOf[C, T]()}
+}
+
+func pivotRule[C Coordinate, T any](pivotDef PivotFuncOf[C, T]) uint8 {
+	pivotRules := pivotRulesOf[C, T]()
+	for i := 1; i < len(pivotRules); i++ {
+		if sameFunc(pivotDef, pivotRules[i]) {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+func axisRule[C Coordinate, T any](axisDef AxisFuncOf[C, T]) uint8 {
+	axisRules := axisRulesOf[C, T]()
+	for i := 1; i < len(axisRules); i++ {
+		if sameFunc(axisDef, axisRules[i]) {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+// coordinateKinds lists the kinds of Coordinate in the order of the coordType
+// header field.
+var coordinateKinds = []reflect.Kind{reflect.Float64, reflect.Float32, reflect.Int8, reflect.Int16,
+	reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32}
+
+func coordinateType[C Coordinate]() uint8 {
+	kind := reflect.TypeOf(*new(C)).Kind()
+	for i, k := range coordinateKinds {
+		if k == kind {
+			return uint8(i)
+		}
+	}
+	panic(fmt.Sprintf("kdtree: no coordinate type for %v", kind))
+}
+
+// sameFunc reports whether the non-nil funcs f and g are the same function value.
+func sameFunc(f, g interface{}) bool {
+	vf, vg := reflect.ValueOf(f), reflect.ValueOf(g)
+	return !vf.IsNil() && !vg.IsNil() && vf.Pointer() == vg.Pointer()
+}
+
+// WriteTo implements io.WriterTo, writing the k-d tree in a compact, versioned
+// binary form in which every pivot and live Datapoint is stored exactly once.
+// Data payloads are stored as JSON, and are decoded by ReadFrom as they would be
+// by UnmarshalJSON.
+func (branch *TreeOf[C, T]) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	enc := encoder{w: bufio.NewWriter(cw), coordType: coordinateType[C]()}
+
+	dimensionality := branch.box.Dimensionality()
+	if dimensionality > maxBinaryDimensionality {
+		return 0, fmt.Errorf("kdtree: cannot write Datapoints of dimensionality %d, above %d",
+			dimensionality, maxBinaryDimensionality)
+	}
+	if nesting := branch.MaxDepth() - branch.depth; nesting > maxBinaryNesting {
+		return 0, fmt.Errorf("kdtree: cannot write branches nested %d deep, above %d", nesting, maxBinaryNesting)
+	}
+	nodes, points := branch.census()
+
+	enc.write([]byte(binaryMagic))
+	enc.uint16(binaryVersion)
+	enc.uint16(binaryMinReader)
+	enc.uint32(binaryHeaderLen)
+	enc.uint32(uint32(dimensionality))
+	opts := branch.options()
+	enc.write([]byte{pivotRule(opts.Pivot)})
+	enc.uint32(uint32(opts.LeafSize))
+	enc.uint32(uint32(int32(branch.depth)))
+	enc.uint64(uint64(nodes))
+	enc.uint64(uint64(points))
+	enc.uint32(uint32(int32(opts.MaxDepth)))
+	enc.write([]byte{axisRule(opts.Axis)})
+	enc.write([]byte{enc.coordType})
+	encodeBranch(&enc, branch)
+
+	if enc.err == nil {
+		enc.err = enc.w.Flush()
+	}
+	return cw.n, enc.err
+}
+
+// census returns the number of branches and of live Datapoints in the tree.
+func (branch *TreeOf[C, T]) census() (nodes, points int) {
+	if branch == nil {
+		return 0, 0
+	}
+	if branch.isLeaf() {
+		return 1, branch.size()
+	}
+	ln, lp := branch.left.census()
+	rn, rp := branch.right.census()
+	return 1 + ln + rn, lp + rp
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type encoder struct {
+	w         *bufio.Writer
+	scratch   [binary.MaxVarintLen64]byte
+	err       error
+	coordType uint8
+}
+
+func (enc *encoder) write(p []byte) {
+	if enc.err == nil {
+		_, enc.err = enc.w.Write(p)
+	}
+}
+
+func (enc *encoder) uint16(v uint16) {
+	binary.LittleEndian.PutUint16(enc.scratch[:], v)
+	enc.write(enc.scratch[:2])
+}
+
+func (enc *encoder) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(enc.scratch[:], v)
+	enc.write(enc.scratch[:4])
+}
+
+func (enc *encoder) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(enc.scratch[:], v)
+	enc.write(enc.scratch[:8])
+}
+
+func (enc *encoder) uvarint(v uint64) {
+	enc.write(enc.scratch[:binary.PutUvarint(enc.scratch[:], v)])
+}
+
+// coordinate writes v, which must be exactly representable as coordType, in the
+// width of coordType.
+func (enc *encoder) coordinate(v float64) {
+	switch coordinateKinds[enc.coordType] {
+	case reflect.Float64:
+		enc.uint64(math.Float64bits(v))
+	case reflect.Float32:
+		enc.uint32(math.Float32bits(float32(v)))
+	case reflect.Int8:
+		enc.write([]byte{byte(int8(v))})
+	case reflect.Uint8:
+		enc.write([]byte{byte(v)})
+	case reflect.Int16:
+		enc.uint16(uint16(int16(v)))
+	case reflect.Uint16:
+		enc.uint16(uint16(v))
+	case reflect.Int32:
+		enc.uint32(uint32(int32(v)))
+	case reflect.Uint32:
+		enc.uint32(uint32(v))
+	}
+}
+
+func encodeBranch[C Coordinate, T any](enc *encoder, branch *TreeOf[C, T]) {
+	if enc.err != nil {
+		return
+	}
+	if !branch.isLeaf() {
+		enc.write([]byte{internalNode})
+		enc.uint64(math.Float64bits(branch.pivot))
+		enc.uvarint(uint64(branch.axis))
+		encodeBranch(enc, branch.left)
+		encodeBranch(enc, branch.right)
+		return
+	}
+
+	enc.write([]byte{leafNode})
+	enc.uvarint(uint64(branch.size()))
+	for i, d := range branch.Datapoints {
+		if d == nil || branch.isTombstoned(i) {
+			continue
+		}
+		for _, f := range d.set {
+			enc.coordinate(float64(f))
+		}
+		if any(d.data) == nil {
+			enc.uvarint(0)
+			continue
+		}
+		data, err := json.Marshal(d.data)
+		if err != nil && enc.err == nil {
+			enc.err = err
+		}
+		enc.uvarint(uint64(len(data)))
+		enc.write(data)
+	}
+}
+
+// ReadFrom implements io.ReaderFrom, replacing the branch with the k-d tree read
+// from r, as written by WriteTo. The input is checked as it is read: besides its
+// header and structure, every Datapoint must be finite, of the dimensionality in
+// the header, and lie on the correct side of each pivot above it. Values written
+// with another coordinate type are converted, and must be exactly representable
+// as C. Otherwise an
+// error wrapping ErrFormat, or ErrVersion for a format too new to read, is
+// returned and the branch is left unchanged.
+// Unless r is an io.ByteReader, it is buffered, and may be read past the end of the tree.
+func (branch *TreeOf[C, T]) ReadFrom(r io.Reader) (int64, error) {
+	dec := decoder[C, T]{}
+	if br, ok := r.(byteReader); ok {
+		dec.r = br
+	} else {
+		dec.r = bufio.NewReader(r)
+	}
+	tree, err := dec.tree()
+	if err != nil {
+		return dec.n, err
+	}
+	*branch = *tree
+	return dec.n, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+type decoder[C Coordinate, T any] struct {
+	r       byteReader
+	n       int64
+	scratch [8]byte
+
+	version        uint16
+	coordType      uint8
+	dimensionality int
+	opts           *BuildOptionsOf[C, T]
+	nodes, points  uint64 // remaining, as declared in the header
+	rootDepth      int
+	lo, hi         []float64
+}
+
+func (dec *decoder[C, T]) read(p []byte) error {
+	n, err := io.ReadFull(dec.r, p)
+	dec.n += int64(n)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	return nil
+}
+
+func (dec *decoder[C, T]) uint16() (uint16, error) {
+	err := dec.read(dec.scratch[:2])
+	return binary.LittleEndian.Uint16(dec.scratch[:]), err
+}
+
+func (dec *decoder[C, T]) uint32() (uint32, error) {
+	err := dec.read(dec.scratch[:4])
+	return binary.LittleEndian.Uint32(dec.scratch[:]), err
+}
+
+func (dec *decoder[C, T]) uint64() (uint64, error) {
+	err := dec.read(dec.scratch[:8])
+	return binary.LittleEndian.Uint64(dec.scratch[:]), err
+}
+
+func (dec *decoder[C, T]) uint8() (uint8, error) {
+	err := dec.read(dec.scratch[:1])
+	return dec.scratch[0], err
+}
+
+// coordinate reads a value written as the coordType in the header.
+func (dec *decoder[C, T]) coordinate() (float64, error) {
+	switch coordinateKinds[dec.coordType] {
+	case reflect.Float32:
+		v, err := dec.uint32()
+		return float64(math.Float32frombits(v)), err
+	case reflect.Int8:
+		v, err := dec.uint8()
+		return float64(int8(v)), err
+	case reflect.Uint8:
+		v, err := dec.uint8()
+		return float64(v), err
+	case reflect.Int16:
+		v, err := dec.uint16()
+		return float64(int16(v)), err
+	case reflect.Uint16:
+		v, err := dec.uint16()
+		return float64(v), err
+	case reflect.Int32:
+		v, err := dec.uint32()
+		return float64(int32(v)), err
+	case reflect.Uint32:
+		v, err := dec.uint32()
+		return float64(v), err
+	}
+	v, err := dec.uint64()
+	return math.Float64frombits(v), err
+}
+
+func (dec *decoder[C, T]) uvarint() (uint64, error) {
+	v, err := binary.ReadUvarint(countingByteReader{dec.r, &dec.n})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	return v, nil
+}
+
+type countingByteReader struct {
+	r io.ByteReader
+	n *int64
+}
+
+func (c countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		*c.n++
+	}
+	return b, err
+}
+
+func (dec *decoder[C, T]) tree() (*TreeOf[C, T], error) {
+	magic := make([]byte, len(binaryMagic), len(binaryMagic))
+	if err := dec.read(magic); err != nil {
+		return nil, err
+	}
+	if string(magic) != binaryMagic {
+		return nil, fmt.Errorf("%w: not a k-d tree", ErrFormat)
+	}
+	version, err := dec.uint16()
+	if err != nil {
+		return nil, err
+	}
+	dec.version = version
+	minReader, err := dec.uint16()
+	if err != nil {
+		return nil, err
+	}
+	if minReader > binaryVersion {
+		return nil, fmt.Errorf("%w: written in version %d, needs a reader of version %d, have %d",
+			ErrVersion, version, minReader, binaryVersion)
+	}
+	headerLen, err := dec.uint32()
+	if err != nil {
+		return nil, err
+	}
+	known := uint32(binaryHeaderLen)
+	switch {
+	case version < 2:
+		known = binaryHeaderLenV1
+	case version < 3:
+		known = binaryHeaderLenV2
+	}
+	if headerLen < known {
+		return nil, fmt.Errorf("%w: header of %d bytes is too short", ErrFormat, headerLen)
+	}
+
+	var fields [binaryHeaderLen]byte
+	if err := dec.read(fields[:known]); err != nil {
+		return nil, err
+	}
+	skipped, err := io.CopyN(io.Discard, dec.r, int64(headerLen-known))
+	dec.n += skipped
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+
+	dec.dimensionality = int(binary.LittleEndian.Uint32(fields[0:]))
+	if dec.dimensionality > maxBinaryDimensionality {
+		return nil, fmt.Errorf("%w: dimensionality %d is above %d", ErrFormat, dec.dimensionality, maxBinaryDimensionality)
+	}
+	pivotRules, axisRules := pivotRulesOf[C, T](), axisRulesOf[C, T]()
+	rule := fields[4]
+	if int(rule) >= len(pivotRules) {
+		return nil, fmt.Errorf("%w: unknown pivot rule %d", ErrFormat, rule)
+	}
+	opts := BuildOptionsOf[C, T]{
+		Pivot:    pivotRules[rule],
+		LeafSize: int(binary.LittleEndian.Uint32(fields[5:])),
+	}
+	if version >= 2 {
+		opts.MaxDepth = int(int32(binary.LittleEndian.Uint32(fields[29:])))
+		rule := fields[33]
+		if int(rule) >= len(axisRules) {
+			return nil, fmt.Errorf("%w: unknown axis rule %d", ErrFormat, rule)
+		}
+		opts.Axis = axisRules[rule]
+	}
+	if version >= 3 {
+		dec.coordType = fields[34]
+		if int(dec.coordType) >= len(coordinateKinds) {
+			return nil, fmt.Errorf("%w: unknown coordinate type %d", ErrFormat, dec.coordType)
+		}
+	}
+	dec.opts = opts.withDefaults()
+	depth := int(int32(binary.LittleEndian.Uint32(fields[9:])))
+	dec.rootDepth = depth
+	dec.nodes = binary.LittleEndian.Uint64(fields[13:])
+	dec.points = binary.LittleEndian.Uint64(fields[21:])
+	if dec.points > 0 && dec.dimensionality == 0 {
+		return nil, fmt.Errorf("%w: Datapoints of no dimensionality", ErrFormat)
+	}
+
+	dec.lo = make([]float64, 0, dec.dimensionality)
+	dec.hi = make([]float64, 0, dec.dimensionality)
+	for axis := 0; axis < dec.dimensionality; axis++ {
+		dec.lo = append(dec.lo, math.Inf(-1))
+		dec.hi = append(dec.hi, math.Inf(1))
+	}
+
+	root, err := dec.branch(depth)
+	if err != nil {
+		return nil, err
+	}
+	if dec.nodes != 0 || dec.points != 0 {
+		return nil, fmt.Errorf("%w: %d branches and %d Datapoints declared but missing", ErrFormat, dec.nodes, dec.points)
+	}
+	return root, nil
+}
+
+func (dec *decoder[C, T]) branch(depth int) (*TreeOf[C, T], error) {
+	if dec.nodes == 0 {
+		return nil, fmt.Errorf("%w: more branches than declared", ErrFormat)
+	}
+	if depth-dec.rootDepth > maxBinaryNesting {
+		return nil, fmt.Errorf("%w: branches nested more than %d deep", ErrFormat, maxBinaryNesting)
+	}
+	dec.nodes--
+
+	kind, err := dec.uint8()
+	if err != nil {
+		return nil, err
+	}
+	branch := &TreeOf[C, T]{depth: depth, opts: dec.opts}
+
+	switch kind {
+	case internalNode:
+		if dec.dimensionality == 0 {
+			return nil, fmt.Errorf("%w: branch split on no dimensions", ErrFormat)
+		}
+		bits, err := dec.uint64()
+		if err != nil {
+			return nil, err
+		}
+		branch.pivot = math.Float64frombits(bits)
+		axis := depth % dec.dimensionality
+		if dec.version >= 2 {
+			v, err := dec.uvarint()
+			if err != nil {
+				return nil, err
+			}
+			if v >= uint64(dec.dimensionality) {
+				return nil, fmt.Errorf("%w: branch split on axis %d of %d", ErrFormat, v, dec.dimensionality)
+			}
+			axis = int(v)
+		}
+		if math.IsNaN(branch.pivot) || branch.pivot < dec.lo[axis] || branch.pivot > dec.hi[axis] {
+			return nil, fmt.Errorf("%w: pivot %v at depth %d is out of range", ErrFormat, branch.pivot, depth)
+		}
+
+		hi := dec.hi[axis]
+		dec.hi[axis] = branch.pivot
+		branch.left, err = dec.branch(depth + 1)
+		dec.hi[axis] = hi
+		if err != nil {
+			return nil, err
+		}
+		lo := dec.lo[axis]
+		dec.lo[axis] = branch.pivot
+		branch.right, err = dec.branch(depth + 1)
+		dec.lo[axis] = lo
+		if err != nil {
+			return nil, err
+		}
+
+		branch.axis = axis
+		branch.tally()
+		return branch, nil
+
+	case leafNode:
+		count, err := dec.uvarint()
+		if err != nil {
+			return nil, err
+		}
+		if count > dec.points {
+			return nil, fmt.Errorf("%w: more Datapoints than declared", ErrFormat)
+		}
+		dec.points -= count
+		if count == 0 {
+			branch.Datapoints = PointsOf[C, T]{nil}
+		}
+		for i := uint64(0); i < count; i++ {
+			d, err := dec.datapoint()
+			if err != nil {
+				return nil, err
+			}
+			branch.Datapoints = append(branch.Datapoints, d)
+		}
+		branch.tally()
+		return branch, nil
+	}
+	return nil, fmt.Errorf("%w: unknown branch kind %d", ErrFormat, kind)
+}
+
+func (dec *decoder[C, T]) datapoint() (*PointOf[C, T], error) {
+	set := make([]C, dec.dimensionality, dec.dimensionality)
+	for axis := range set {
+		v, err := dec.coordinate()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return nil, fmt.Errorf("%w: Datapoint value %v", ErrFormat, v)
+		}
+		if v < dec.lo[axis] || v >= dec.hi[axis] {
+			return nil, fmt.Errorf("%w: Datapoint value %v on axis %d is on the wrong side of a pivot",
+				ErrFormat, v, axis)
+		}
+		c, ok := toCoordinate[C](v)
+		if !ok {
+			return nil, fmt.Errorf("%w: Datapoint value %v is not a %T", ErrFormat, v, c)
+		}
+		set[axis] = c
+	}
+
+	size, err := dec.uvarint()
+	if err != nil {
+		return nil, err
+	}
+	d := &PointOf[C, T]{set: set}
+	if size == 0 {
+		return d, nil
+	}
+	if size > math.MaxInt32 {
+		return nil, fmt.Errorf("%w: data payload of %d bytes", ErrFormat, size)
+	}
+	var raw bytes.Buffer
+	copied, err := io.CopyN(&raw, dec.r, int64(size))
+	dec.n += copied
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if d.data, err = decodePayload[T](raw.Bytes()); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
@@ -0,0 +1,274 @@
+package kdtree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func Test_Binary_Round_Trip(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -100, 100))
+	}
+	tree := Build(ds, 0, Median)
+	for _, d := range ds[:50] {
+		tree.Delete(d)
+	}
+	for i := 0; i < 50; i++ {
+		tree.Insert(RandomDatapointInRange(3, -100, 100))
+	}
+
+	var buf bytes.Buffer
+	written, err := tree.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != int64(buf.Len()) {
+		t.Error(`want: `, buf.Len(), ` bytes written
+		got: `, written)
+	}
+	size := buf.Len()
+
+	var loaded Branch
+	read, err := loaded.ReadFrom(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read != int64(size) {
+		t.Error(`want: `, size, ` bytes read
+		got: `, read)
+	}
+
+	wantNodes, wantPoints := tree.census()
+	gotNodes, gotPoints := loaded.census()
+	if gotNodes != wantNodes || gotPoints != wantPoints || loaded.size() != wantPoints {
+		t.Error(`want: `, wantNodes, ` branches, `, wantPoints, ` Datapoints
+		got: `, gotNodes, ` branches, `, gotPoints, ` Datapoints`)
+	}
+	if pivotRule(loaded.options().Pivot) != pivotRule(Median) {
+		t.Error(`want: Median pivot rule recorded in the header`)
+	}
+	for i := 0; i < 50; i++ {
+		target := RandomDatapointInRange(3, -100, 100)
+		want := KNN(tree, target, 3, nil)
+		got := KNN(&loaded, target, 3, nil)
+		if !got.EqualTo(want) {
+			t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+		}
+	}
+
+	jsonTree, _ := json.Marshal(tree)
+	if size*10 > len(jsonTree) {
+		t.Error(`binary form of `, size, ` bytes is not much smaller than JSON of `, len(jsonTree))
+	}
+}
+
+func Test_Binary_Data_Payloads_And_Depth(t *testing.T) {
+	ds := Datapoints{
+		NewDatapoint("alpha", []float64{1}),
+		NewDatapoint(map[string]interface{}{"b": 2.0}, []float64{2}),
+		NewDatapoint(nil, []float64{3}),
+	}
+	tree := Build(ds, 4, Mean)
+
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var loaded Branch
+	if _, err := loaded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.depth != 4 || pivotRule(loaded.options().Pivot) != pivotRule(Mean) {
+		t.Error(`want: depth 4, Mean
+		got: depth `, loaded.depth, `, rule `, pivotRule(loaded.options().Pivot))
+	}
+	want, _ := json.Marshal(tree)
+	got, _ := json.Marshal(&loaded)
+	if string(got) != string(want) {
+		t.Error(`want: `, string(want), `
+		got: `, string(got))
+	}
+}
+
+func Test_Binary_Forward_Compatible_Header(t *testing.T) {
+	tree := Build(append(Datapoints{}, dps1...), 0, Median)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	current := buf.Bytes()
+
+	// a later version which appends a header field readers of version 1 can skip
+	extended := append([]byte{}, current[:len(binaryMagic)]...)
+	extended = binary.LittleEndian.AppendUint16(extended, binaryVersion+1)
+	extended = binary.LittleEndian.AppendUint16(extended, binaryMinReader)
+	extended = binary.LittleEndian.AppendUint32(extended, binaryHeaderLen+3)
+	header := len(binaryMagic) + 8
+	extended = append(extended, current[header:header+binaryHeaderLen]...)
+	extended = append(extended, 0xAA, 0xBB, 0xCC)
+	extended = append(extended, current[header+binaryHeaderLen:]...)
+
+	var loaded Branch
+	if _, err := loaded.ReadFrom(bytes.NewReader(extended)); err != nil {
+		t.Error(`want: later version with a compatible reader read
+		got: `, err)
+	}
+	if loaded.size() != len(dps1) {
+		t.Error(`want: `, len(dps1), `
+		got: `, loaded.size())
+	}
+
+	// a later version which this reader cannot understand
+	incompatible := append([]byte{}, current...)
+	binary.LittleEndian.PutUint16(incompatible[len(binaryMagic)+2:], binaryVersion+1)
+	if _, err := loaded.ReadFrom(bytes.NewReader(incompatible)); !errors.Is(err, ErrVersion) {
+		t.Error(`want: `, ErrVersion, `
+		got: `, err)
+	}
+}
+
+func Test_Binary_Reads_Version_1(t *testing.T) {
+	ds := Datapoints{
+		&Datapoint{nil, []float64{1, 2}},
+		&Datapoint{nil, []float64{5, 6}},
+	}
+	tree := Build(ds, 0, Median)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	current := buf.Bytes()
+
+	// version 1 had neither the last two header fields nor the axis of each branch
+	header := len(binaryMagic) + 8
+	old := append([]byte{}, current[:len(binaryMagic)]...)
+	old = binary.LittleEndian.AppendUint16(old, 1)
+	old = binary.LittleEndian.AppendUint16(old, 1)
+	old = binary.LittleEndian.AppendUint32(old, binaryHeaderLenV1)
+	old = append(old, current[header:header+binaryHeaderLenV1]...)
+	root := header + binaryHeaderLen
+	old = append(old, current[root:root+1+8]...)
+	old = append(old, current[root+1+8+1:]...)
+
+	var loaded Branch
+	if _, err := loaded.ReadFrom(bytes.NewReader(old)); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(tree)
+	got, _ := json.Marshal(&loaded)
+	if string(got) != string(want) || loaded.axis != 0 {
+		t.Error(`want: `, string(want), `
+		got: `, string(got))
+	}
+}
+
+func Test_Binary_Reads_Version_2(t *testing.T) {
+	tree := Build(append(Datapoints{}, dps1...), 0, Median)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	current := buf.Bytes()
+
+	// version 2 had no coordinate type, writing every value as a float64
+	header := len(binaryMagic) + 8
+	old := append([]byte{}, current[:len(binaryMagic)]...)
+	old = binary.LittleEndian.AppendUint16(old, 2)
+	old = binary.LittleEndian.AppendUint16(old, 2)
+	old = binary.LittleEndian.AppendUint32(old, binaryHeaderLenV2)
+	old = append(old, current[header:header+binaryHeaderLenV2]...)
+	old = append(old, current[header+binaryHeaderLen:]...)
+
+	var loaded Branch
+	if _, err := loaded.ReadFrom(bytes.NewReader(old)); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(tree)
+	got, _ := json.Marshal(&loaded)
+	if string(got) != string(want) {
+		t.Error(`want: `, string(want), `
+		got: `, string(got))
+	}
+}
+
+func Test_Binary_Rejects_Malformed_Input(t *testing.T) {
+	ds := Datapoints{
+		&Datapoint{nil, []float64{1, 2}},
+		&Datapoint{nil, []float64{5, 6}},
+	}
+	tree := Build(ds, 0, Median)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	valid := buf.Bytes()
+
+	for i := 0; i < len(valid); i++ {
+		var loaded Branch
+		if _, err := loaded.ReadFrom(bytes.NewReader(valid[:i])); !errors.Is(err, ErrFormat) {
+			t.Error(`truncated to `, i, ` bytes, want: `, ErrFormat, `
+		got: `, err)
+		}
+	}
+
+	// the single pivot is 5 on x; move the first Datapoint to the wrong side of it
+	header := len(binaryMagic) + 8 + binaryHeaderLen
+	leaf := header + 1 + 8 + 1
+	corruptions := map[string]func([]byte){
+		"magic":       func(b []byte) { b[0] = 'X' },
+		"pivot rule":  func(b []byte) { b[len(binaryMagic)+8+4] = 200 },
+		"branch kind": func(b []byte) { b[header] = 7 },
+		"pivot NaN": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[header+1:], math.Float64bits(math.NaN()))
+		},
+		"axis":            func(b []byte) { b[header+1+8] = 2 },
+		"axis rule":       func(b []byte) { b[header-2] = 200 },
+		"coordinate type": func(b []byte) { b[header-1] = 200 },
+		"Datapoint side": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[leaf+2:], math.Float64bits(9))
+		},
+		"Datapoint Inf": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[leaf+2:], math.Float64bits(math.Inf(-1)))
+		},
+		"dimensionality": func(b []byte) {
+			binary.LittleEndian.PutUint32(b[len(binaryMagic)+8:], 0x3fffffff)
+		},
+		"dimensionality just above the limit": func(b []byte) {
+			binary.LittleEndian.PutUint32(b[len(binaryMagic)+8:], maxBinaryDimensionality+1)
+		},
+		"nodes": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[len(binaryMagic)+8+13:], math.MaxUint64)
+		},
+		"points": func(b []byte) {
+			binary.LittleEndian.PutUint64(b[len(binaryMagic)+8+21:], math.MaxUint64)
+		},
+	}
+	for name, corrupt := range corruptions {
+		b := append([]byte{}, valid...)
+		corrupt(b)
+		var loaded Branch
+		if _, err := loaded.ReadFrom(bytes.NewReader(b)); !errors.Is(err, ErrFormat) {
+			t.Error(name, `, want: `, ErrFormat, `
+		got: `, err)
+		}
+	}
+}
+
+func Test_Binary_Rejects_Deep_Nesting(t *testing.T) {
+	tree := Build(Datapoints{&Datapoint{nil, []float64{1}}}, 0, nil)
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	header := len(binaryMagic) + 8 + binaryHeaderLen
+	deep := append([]byte{}, buf.Bytes()[:header]...)
+	binary.LittleEndian.PutUint64(deep[len(binaryMagic)+8+13:], math.MaxUint64)
+
+	// every branch splits at the same pivot, leaving room for the next below it
+	for i := 0; i <= maxBinaryNesting; i++ {
+		deep = append(deep, internalNode)
+		deep = binary.LittleEndian.AppendUint64(deep, math.Float64bits(0))
+		deep = append(deep, 0)
+	}
+	var loaded Branch
+	if _, err := loaded.ReadFrom(bytes.NewReader(deep)); !errors.Is(err, ErrFormat) {
+		t.Error(`want: `, ErrFormat, `
+		got: `, err)
+	}
+}
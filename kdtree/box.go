@@ -0,0 +1,238 @@
+package kdtree
+
+import (
+	"fmt"
+	"math"
+)
+
+// BoxOf is an axis-aligned hyperrectangle of coordinates of type C, closed on
+// every side: the points whose value along each axis lies between the Box's
+// lower and upper bounds on it.
+// The zero Box is empty, holding no points at all.
+// A Box is never modified once made, so it can be shared freely.
+type BoxOf[C Coordinate] struct {
+	min, max []C
+}
+
+// Box is the BoxOf floating-point values, as bounds a Branch of Datapoints.
+type Box = BoxOf[float64]
+
+// NewBox returns the Box between the lower and upper bounds on each axis, either
+// of which may be infinite. It fails if they differ in dimensionality, or if any
+// bound is NaN or a lower bound is above its upper bound.
+func NewBox[C Coordinate](min, max []C) (BoxOf[C], error) {
+	if len(min) != len(max) {
+		return BoxOf[C]{}, fmt.Errorf("kdtree: Box bounds of dimensionality %d and %d", len(min), len(max))
+	}
+	b := BoxOf[C]{min: make([]C, len(min), len(min)), max: make([]C, len(max), len(max))}
+	for axis := range min {
+		if math.IsNaN(float64(min[axis])) || math.IsNaN(float64(max[axis])) || min[axis] > max[axis] {
+			return BoxOf[C]{}, fmt.Errorf("kdtree: Box bounds [%v, %v] on axis %d", min[axis], max[axis], axis)
+		}
+		b.min[axis], b.max[axis] = min[axis], max[axis]
+	}
+	return b, nil
+}
+
+// BoxAround returns the smallest Box holding every point in ds, skipping any
+// nil ones. It is empty if there are none.
+func BoxAround[C Coordinate, T any](ds PointsOf[C, T]) BoxOf[C] {
+	var b BoxOf[C]
+	for _, d := range ds {
+		if d == nil {
+			continue
+		}
+		if b.min == nil {
+			b.min = append([]C(nil), d.set...)
+			b.max = append([]C(nil), d.set...)
+			continue
+		}
+		for axis, v := range d.set {
+			if v < b.min[axis] {
+				b.min[axis] = v
+			}
+			if v > b.max[axis] {
+				b.max[axis] = v
+			}
+		}
+	}
+	return b
+}
+
+// Empty reports whether the Box holds no points.
+func (b BoxOf[C]) Empty() bool {
+	return b.min == nil
+}
+
+// Dimensionality returns the number of axes the Box spans.
+func (b BoxOf[C]) Dimensionality() int {
+	return len(b.min)
+}
+
+// Min returns a copy of the lower bound on each axis.
+func (b BoxOf[C]) Min() []C {
+	return append([]C(nil), b.min...)
+}
+
+// Max returns a copy of the upper bound on each axis.
+func (b BoxOf[C]) Max() []C {
+	return append([]C(nil), b.max...)
+}
+
+// Contains reports whether the point with the coordinates set lies inside the
+// Box, boundary included.
+func (b BoxOf[C]) Contains(set []C) bool {
+	if b.Empty() || len(set) != len(b.min) {
+		return false
+	}
+	for axis, v := range set {
+		if v < b.min[axis] || v > b.max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// ContainsBox reports whether every point of o lies inside the Box. The empty
+// Box is contained by every other.
+func (b BoxOf[C]) ContainsBox(o BoxOf[C]) bool {
+	if o.Empty() {
+		return true
+	}
+	if b.Empty() || len(o.min) != len(b.min) {
+		return false
+	}
+	for axis := range b.min {
+		if o.min[axis] < b.min[axis] || o.max[axis] > b.max[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersects reports whether the Box and o have any point in common.
+func (b BoxOf[C]) Intersects(o BoxOf[C]) bool {
+	if b.Empty() || o.Empty() || len(o.min) != len(b.min) {
+		return false
+	}
+	for axis := range b.min {
+		if o.min[axis] > b.max[axis] || o.max[axis] < b.min[axis] {
+			return false
+		}
+	}
+	return true
+}
+
+// Intersect returns the Box of the points in both the Box and o, which is empty
+// if they have none in common.
+func (b BoxOf[C]) Intersect(o BoxOf[C]) BoxOf[C] {
+	if b.Empty() || o.Empty() || len(o.min) != len(b.min) {
+		return BoxOf[C]{}
+	}
+	i := BoxOf[C]{min: make([]C, len(b.min), len(b.min)), max: make([]C, len(b.max), len(b.max))}
+	for axis := range b.min {
+		i.min[axis], i.max[axis] = b.min[axis], b.max[axis]
+		if o.min[axis] > i.min[axis] {
+			i.min[axis] = o.min[axis]
+		}
+		if o.max[axis] < i.max[axis] {
+			i.max[axis] = o.max[axis]
+		}
+		if i.min[axis] > i.max[axis] {
+			return BoxOf[C]{}
+		}
+	}
+	return i
+}
+
+// Union returns the smallest Box holding both the Box and o, which must be of
+// the same dimensionality unless either is empty.
+func (b BoxOf[C]) Union(o BoxOf[C]) BoxOf[C] {
+	if b.Empty() {
+		return o
+	}
+	if o.Empty() {
+		return b
+	}
+	u := BoxOf[C]{min: make([]C, len(b.min), len(b.min)), max: make([]C, len(b.max), len(b.max))}
+	for axis := range b.min {
+		u.min[axis], u.max[axis] = b.min[axis], b.max[axis]
+		if o.min[axis] < u.min[axis] {
+			u.min[axis] = o.min[axis]
+		}
+		if o.max[axis] > u.max[axis] {
+			u.max[axis] = o.max[axis]
+		}
+	}
+	return u
+}
+
+// Volume returns the product of the Box's extent along each axis: 0 for an
+// empty Box or one which is flat along any axis, and +Inf for an unbounded one.
+func (b BoxOf[C]) Volume() float64 {
+	if b.Empty() {
+		return 0
+	}
+	volume := 1.0
+	for axis := range b.min {
+		extent := float64(b.max[axis]) - float64(b.min[axis])
+		if extent == 0 {
+			return 0
+		}
+		volume *= extent
+	}
+	return volume
+}
+
+// MinDistance returns the Euclidean distance from the point with the coordinates
+// target to the nearest point of the Box: 0 if it is inside it, and +Inf if the
+// Box is empty.
+func (b BoxOf[C]) MinDistance(target []C) float64 {
+	if b.Empty() {
+		return math.Inf(1)
+	}
+	var sq float64
+	for axis, v := range target {
+		gap := b.gap(axis, v)
+		sq += gap * gap
+	}
+	return math.Sqrt(sq)
+}
+
+// Ranges returns the bounds of the Box on each axis, as taken by RangeQuery.
+func (b BoxOf[C]) Ranges() []Range {
+	bounds := make([]Range, len(b.min), len(b.min))
+	for axis := range b.min {
+		bounds[axis] = Closed(float64(b.min[axis]), float64(b.max[axis]))
+	}
+	return bounds
+}
+
+// gap returns how far v lies outside the Box's bounds on axis.
+func (b BoxOf[C]) gap(axis int, v C) float64 {
+	switch {
+	case v < b.min[axis]:
+		return float64(b.min[axis]) - float64(v)
+	case v > b.max[axis]:
+		return float64(v) - float64(b.max[axis])
+	}
+	return 0
+}
+
+// lowerBound returns a lower bound on the distance under metric from target to
+// any point in the Box, or +Inf if it is empty.
+func (b BoxOf[C]) lowerBound(target []C, metric MetricOf[C]) float64 {
+	if b.Empty() {
+		return math.Inf(1)
+	}
+	if m, ok := metric.(boxBounder[C]); ok {
+		return m.boxBound(b, target)
+	}
+	var bound float64
+	for axis, v := range target {
+		if gap := b.gap(axis, v); gap > 0 {
+			bound = math.Max(bound, metric.AxisBound(axis, gap))
+		}
+	}
+	return bound
+}
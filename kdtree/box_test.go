@@ -0,0 +1,149 @@
+package kdtree
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_Box_Constructors(t *testing.T) {
+	for _, bounds := range [][2][]float64{
+		{{0, 0}, {1}},
+		{{2}, {1}},
+		{{math.NaN()}, {1}},
+	} {
+		if _, err := NewBox(bounds[0], bounds[1]); err == nil {
+			t.Error(`want: error for bounds `, bounds)
+		}
+	}
+
+	min, max := []float64{0, math.Inf(-1)}, []float64{2, 5}
+	b, err := NewBox(min, max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	min[0] = 9
+	if got := b.Min(); got[0] != 0 || got[1] != math.Inf(-1) || b.Dimensionality() != 2 {
+		t.Error(`want: NewBox to copy its bounds
+		got: `, got)
+	}
+
+	around := BoxAround(Datapoints{
+		&Datapoint{nil, []float64{1, 5}},
+		nil,
+		&Datapoint{nil, []float64{-2, 7}},
+	})
+	if got := around.Min(); got[0] != -2 || got[1] != 5 {
+		t.Error(`want: [-2 5]
+		got: `, got)
+	}
+	if got := around.Max(); got[0] != 1 || got[1] != 7 {
+		t.Error(`want: [1 7]
+		got: `, got)
+	}
+	if !BoxAround(Datapoints(nil)).Empty() || !BoxAround(Datapoints{nil}).Empty() {
+		t.Error(`want: an empty Box around no Datapoints`)
+	}
+}
+
+func Test_Box_Operations(t *testing.T) {
+	a, _ := NewBox([]float64{0, 0}, []float64{4, 2})
+	b, _ := NewBox([]float64{3, 1}, []float64{6, 5})
+	c, _ := NewBox([]float64{5, 3}, []float64{6, 5})
+
+	if got := a.Volume(); got != 8 {
+		t.Error(`want: 8
+		got: `, got)
+	}
+	if !a.Intersects(b) || a.Intersects(c) {
+		t.Error(`want: a to intersect b, not c`)
+	}
+	i := a.Intersect(b)
+	if got := i.Min(); got[0] != 3 || got[1] != 1 || i.Volume() != 1 {
+		t.Error(`want: [3,4]x[1,2]
+		got: `, i.Min(), i.Max())
+	}
+	if !a.Intersect(c).Empty() {
+		t.Error(`want: the empty intersection of disjoint boxes`)
+	}
+	u := a.Union(c)
+	if u.Volume() != 30 || !u.ContainsBox(a) || !u.ContainsBox(c) || a.ContainsBox(u) {
+		t.Error(`want: [0,6]x[0,5]
+		got: `, u.Min(), u.Max())
+	}
+	if !a.Union(Box{}).ContainsBox(a) || !a.ContainsBox(Box{}) || (Box{}).Volume() != 0 {
+		t.Error(`want: the empty Box to be the identity of Union`)
+	}
+
+	for _, c := range []struct {
+		point    []float64
+		contains bool
+		dist     float64
+	}{
+		{[]float64{2, 1}, true, 0},
+		{[]float64{4, 2}, true, 0},
+		{[]float64{7, 1}, false, 3},
+		{[]float64{7, 6}, false, 5},
+		{[]float64{-1, -1}, false, math.Sqrt(2)},
+	} {
+		d := &Datapoint{nil, c.point}
+		if got := a.Contains(d.set); got != c.contains {
+			t.Error(c.point, ` want: contained `, c.contains, `
+		got: `, got)
+		}
+		if got := a.MinDistance(d.set); math.Abs(got-c.dist) > 1e-12 {
+			t.Error(c.point, ` want: distance `, c.dist, `
+		got: `, got)
+		}
+	}
+	if !math.IsInf((Box{}).MinDistance([]float64{0, 0}), 1) {
+		t.Error(`want: +Inf to the empty Box`)
+	}
+}
+
+func Test_Box_Bounds_Every_Branch(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -50, 50))
+	}
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, LeafSize: 4})
+	for _, d := range ds[:100] {
+		tree.Delete(d)
+	}
+	for i := 0; i < 100; i++ {
+		tree.Insert(RandomDatapointInRange(3, -100, 100))
+	}
+
+	var walk func(b *Branch)
+	walk = func(b *Branch) {
+		want := BoxAround(b.entries())
+		if !b.box.ContainsBox(want) || !want.ContainsBox(b.box) {
+			t.Error(`want: the tight box `, want.Min(), want.Max(), ` at depth `, b.depth, `
+		got: `, b.box.Min(), b.box.Max())
+		}
+		if !b.isLeaf() {
+			walk(b.left)
+			walk(b.right)
+		}
+	}
+	walk(tree)
+
+	query, _ := NewBox([]float64{-20, -30, math.Inf(-1)}, []float64{40, 10, 0})
+	var want Datapoints
+	for _, d := range tree.Points() {
+		if query.Contains(d.set) {
+			want = append(want, d)
+		}
+	}
+	got := byIdentity(RangeQuery(tree, query.Ranges()))
+	want = byIdentity(want)
+	if len(got) != len(want) {
+		t.Fatal(`want: `, len(want), `
+		got: `, len(got))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Error(`want: `, want[i].set, `
+		got: `, got[i].set)
+		}
+	}
+}
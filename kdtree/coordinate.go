@@ -0,0 +1,15 @@
+package kdtree
+
+// Coordinate is the type of the values of a PointOf along each axis. Every
+// Coordinate converts to float64 exactly, which is the type a TreeOf holds its
+// pivots in and its Metrics accumulate distances in, so that neither overflows
+// nor loses precision as the coordinates themselves would.
+type Coordinate interface {
+	~int8 | ~int16 | ~int32 | ~uint8 | ~uint16 | ~uint32 | ~float32 | ~float64
+}
+
+// toCoordinate returns v as a C, reporting whether it converts exactly.
+func toCoordinate[C Coordinate](v float64) (C, bool) {
+	c := C(v)
+	return c, float64(c) == v
+}
@@ -0,0 +1,381 @@
+package kdtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// bruteForceKNNOf is the reference oracle for a TreeOf, measuring under metric.
+func bruteForceKNNOf[C Coordinate, T any](ps PointsOf[C, T], target []C, k int, metric MetricOf[C]) []float64 {
+	dists := make([]float64, len(ps), len(ps))
+	for i, p := range ps {
+		dists[i] = metric.Distance(target, p.set)
+	}
+	sort.Float64s(dists)
+	return dists[:min(k, len(dists))]
+}
+
+func checkTreeOf[C Coordinate, T any](t *testing.T, name string, tree *TreeOf[C, T], ps PointsOf[C, T], targets [][]C, metric MetricOf[C]) {
+	t.Helper()
+	if tree.size() != len(ps) {
+		t.Error(name, ` want: `, len(ps), ` points
+		got: `, tree.size())
+	}
+	for _, set := range targets {
+		target := &PointOf[C, T]{set: set}
+		want := bruteForceKNNOf(ps, set, 7, metric)
+		got := KNN(tree, target, 7, metric)
+		if len(got) != len(want) {
+			t.Fatal(name, ` want: `, len(want), ` neighbours
+		got: `, len(got))
+		}
+		for i := range got {
+			if dist := metric.Distance(set, got[i].set); dist != want[i] {
+				t.Error(name, ` neighbour `, i, ` want: `, want[i], `
+		got: `, dist)
+			}
+		}
+		if len(want) > 0 {
+			if nearest, _ := NN(tree, target, metric); metric.Distance(set, nearest.set) != want[0] {
+				t.Error(name, ` NN want: `, want[0], `
+		got: `, metric.Distance(set, nearest.set))
+			}
+			r := want[len(want)-1]
+			if got := RadiusQuery(tree, target, r, metric); len(got) < len(want) {
+				t.Error(name, ` RadiusQuery want: at least `, len(want), `
+		got: `, len(got))
+			}
+		}
+	}
+}
+
+func Test_TreeOf_Int32_Full_Range(t *testing.T) {
+	r := rand.New(rand.NewSource(25))
+	coord := func() int32 { return int32(r.Uint32()) }
+	var ps PointsOf[int32, int]
+	for i := 0; i < 600; i++ {
+		ps = append(ps, NewPointOf(i, []int32{coord(), coord(), coord() % 4}))
+	}
+	ps = append(ps, NewPointOf(-1, []int32{math.MinInt32, math.MinInt32, 0}), NewPointOf(-2, []int32{math.MaxInt32, math.MaxInt32, 0}))
+	var targets [][]int32
+	for i := 0; i < 40; i++ {
+		targets = append(targets, []int32{coord(), coord(), coord() % 4})
+	}
+	targets = append(targets, []int32{math.MaxInt32, math.MinInt32, 0})
+
+	pivots := map[string]PivotFuncOf[int32, int]{
+		"MedianOf":          MedianOf[int32, int](),
+		"QuickMedianOf":     QuickMedianOf[int32, int](),
+		"SlidingMidpointOf": SlidingMidpointOf[int32, int](),
+		"MeanOf":            MeanOf[int32, int](),
+	}
+	for name, pivot := range pivots {
+		tree := BuildWith(ps, 0, BuildOptionsOf[int32, int]{Pivot: pivot, Axis: MaxSpreadOf[int32, int](), LeafSize: 4})
+		checkTreeOf(t, name, tree, ps, targets, EuclideanOf[int32]())
+	}
+}
+
+func Test_TreeOf_Float32_And_Grid(t *testing.T) {
+	r := rand.New(rand.NewSource(25))
+	var embeddings PointsOf[float32, string]
+	for i := 0; i < 500; i++ {
+		set := make([]float32, 16)
+		for axis := range set {
+			set[axis] = r.Float32()
+		}
+		embeddings = append(embeddings, NewPointOf("", set))
+	}
+	var targets [][]float32
+	for i := 0; i < 30; i++ {
+		targets = append(targets, embeddings[r.Intn(len(embeddings))].Set())
+	}
+	checkTreeOf(t, "float32", Build(embeddings, 0, nil), embeddings, targets, EuclideanOf[float32]())
+
+	// a small integer grid, where most points coincide with others
+	var cells PointsOf[uint8, int]
+	for i := 0; i < 800; i++ {
+		cells = append(cells, NewPointOf(i, []uint8{uint8(r.Intn(6)), uint8(r.Intn(6))}))
+	}
+	var gridTargets [][]uint8
+	for x := uint8(0); x < 8; x++ {
+		gridTargets = append(gridTargets, []uint8{x, 7 - x})
+	}
+	for _, pivot := range []PivotFuncOf[uint8, int]{MedianOf[uint8, int](), SlidingMidpointOf[uint8, int](), MeanOf[uint8, int]()} {
+		tree := BuildWith(cells, 0, BuildOptionsOf[uint8, int]{Pivot: pivot, LeafSize: 3})
+		checkTreeOf(t, "uint8", tree, cells, gridTargets, ManhattanOf[uint8]())
+
+		bounds := []Range{NewRange(1, 4, false, true), NewRange(math.Inf(-1), 3, true, false)}
+		want := 0
+		for _, c := range cells {
+			if c.set[0] > 1 && c.set[0] <= 4 && c.set[1] < 3 {
+				want++
+			}
+		}
+		if got := RangeQuery(tree, bounds); len(got) != want || RangeCount(tree, bounds) != want {
+			t.Error(`want: `, want, `
+		got: `, len(got), `, counted `, RangeCount(tree, bounds))
+		}
+		seen := 0
+		for range RangeSeq(tree, bounds) {
+			if seen++; seen == 5 {
+				break
+			}
+		}
+		if seen != min(5, want) {
+			t.Error(`want: RangeSeq stopped after `, min(5, want), `
+		got: `, seen)
+		}
+		if got, want := tree.Multiplicity(&PointOf[uint8, int]{set: []uint8{2, 3}}), countAt(cells, 2, 3); got != want {
+			t.Error(`want: `, want, ` cells at (2, 3)
+		got: `, got)
+		}
+	}
+}
+
+func countAt(cells PointsOf[uint8, int], x, y uint8) int {
+	n := 0
+	for _, c := range cells {
+		if c.set[0] == x && c.set[1] == y {
+			n++
+		}
+	}
+	return n
+}
+
+func Test_TreeOf_Wide_Accumulation(t *testing.T) {
+	lo, hi := []int32{math.MinInt32, math.MinInt32}, []int32{math.MaxInt32, math.MaxInt32}
+	span := float64(math.MaxInt32) - float64(math.MinInt32)
+	want := math.Sqrt(2 * span * span)
+	if got := EuclideanOf[int32]().Distance(lo, hi); got != want {
+		t.Error(`want: `, want, `
+		got: `, got)
+	}
+	if got := ManhattanOf[int32]().Distance(lo, hi); got != 2*(math.MaxInt32-math.MinInt32) {
+		t.Error(`want: `, 2*(math.MaxInt32-math.MinInt32), `
+		got: `, got)
+	}
+	if got := ChebyshevOf[int32]().Distance(lo, hi); got != math.MaxInt32-math.MinInt32 {
+		t.Error(`want: `, math.MaxInt32-math.MinInt32, `
+		got: `, got)
+	}
+	extremes := PointsOf[int32, int]{NewPointOf(0, []int32{math.MaxInt32}), NewPointOf(0, []int32{math.MaxInt32 - 1})}
+	if got := SlidingMidpointOf[int32, int]()(extremes, 0); got != math.MaxInt32-0.5 {
+		t.Error(`want: `, math.MaxInt32-0.5, `
+		got: `, got)
+	}
+	// summed in float32, the 1 would be lost against the 1e8
+	if got, want := EuclideanOf[float32]().Distance([]float32{0, 0}, []float32{1e4, 1}), math.Sqrt(1e8+1); got != want {
+		t.Error(`want: `, want, `
+		got: `, got)
+	}
+}
+
+func Test_TreeOf_Parameterised_Metrics(t *testing.T) {
+	r := rand.New(rand.NewSource(25))
+	var ps PointsOf[int16, int]
+	for i := 0; i < 400; i++ {
+		ps = append(ps, NewPointOf(i, []int16{int16(r.Intn(1000) - 500), int16(r.Intn(1000) - 500)}))
+	}
+	var targets [][]int16
+	for i := 0; i < 20; i++ {
+		targets = append(targets, []int16{int16(r.Intn(1200) - 600), int16(r.Intn(1200) - 600)})
+	}
+	minkowski, err := NewMinkowskiOf[int16](3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	weighted, err := NewWeightedEuclideanOf[int16]([]float64{4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mahalanobis, err := NewMahalanobisOf[int16]([][]float64{{4, 1}, {1, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := BuildWith(ps, 0, BuildOptionsOf[int16, int]{Pivot: QuickMedianOf[int16, int](), LeafSize: 3})
+	for name, metric := range map[string]MetricOf[int16]{"Minkowski": minkowski, "WeightedEuclidean": weighted, "Mahalanobis": mahalanobis} {
+		checkTreeOf(t, name, tree, ps, targets, metric)
+	}
+}
+
+func Test_TreeOf_Insert_Delete(t *testing.T) {
+	r := rand.New(rand.NewSource(25))
+	var ps PointsOf[int16, int]
+	for i := 0; i < 200; i++ {
+		ps = append(ps, NewPointOf(i, []int16{int16(r.Intn(200)), int16(r.Intn(200))}))
+	}
+	tree := BuildWith(ps[:50], 0, BuildOptionsOf[int16, int]{LeafSize: 2})
+	for _, p := range ps[50:] {
+		tree.Insert(p)
+	}
+	for _, p := range ps[:100] {
+		if !tree.Delete(p) || tree.Delete(p) {
+			t.Error(`want: `, p, ` deleted exactly once`)
+		}
+	}
+	live := ps[100:]
+	var targets [][]int16
+	for i := 0; i < 20; i++ {
+		targets = append(targets, []int16{int16(r.Intn(220) - 10), int16(r.Intn(220) - 10)})
+	}
+	checkTreeOf(t, "after Insert and Delete", tree, live, targets, EuclideanOf[int16]())
+	if got := len(tree.Points()); got != len(live) {
+		t.Error(`want: `, len(live), `
+		got: `, got)
+	}
+
+	// a sorted run of inserts stays shallow through scapegoat rebuilds
+	sorted := Build(PointsOf[int16, int]{}, 0, nil)
+	for i := 0; i < 1000; i++ {
+		sorted.Insert(NewPointOf(i, []int16{int16(i), 0}))
+	}
+	if depth := sorted.MaxDepth(); depth > 40 {
+		t.Error(`want: a depth of at most 40
+		got: `, depth)
+	}
+	if nearest, _ := NN(sorted, &PointOf[int16, int]{set: []int16{500, 1}}, nil); nearest.Data() != 500 {
+		t.Error(`want: 500
+		got: `, nearest.Data())
+	}
+}
+
+func Test_TreeOf_Serialisation_Round_Trip(t *testing.T) {
+	r := rand.New(rand.NewSource(25))
+	var ps PointsOf[int16, string]
+	for i := 0; i < 300; i++ {
+		ps = append(ps, NewPointOf(string(rune('a'+i%26)), []int16{int16(r.Intn(2000) - 1000), int16(r.Intn(2000) - 1000)}))
+	}
+	tree := BuildWith(ps, 0, BuildOptionsOf[int16, string]{Pivot: QuickMedianOf[int16, string](), Axis: MaxVarianceOf[int16, string](), LeafSize: 4})
+	for _, p := range ps[:30] {
+		tree.Delete(p)
+	}
+
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var read TreeOf[int16, string]
+	if _, err := read.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if pivotRule(read.options().Pivot) != pivotRule(QuickMedianOf[int16, string]()) || axisRule(read.options().Axis) != axisRule(MaxVarianceOf[int16, string]()) {
+		t.Error(`want: QuickMedianOf and MaxVarianceOf rules recorded in the header`)
+	}
+
+	encoded, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var unmarshalled TreeOf[int16, string]
+	if err := json.Unmarshal(encoded, &unmarshalled); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, loaded := range map[string]*TreeOf[int16, string]{"ReadFrom": &read, "UnmarshalJSON": &unmarshalled} {
+		if loaded.size() != tree.size() {
+			t.Error(name, ` want: `, tree.size(), `
+		got: `, loaded.size())
+		}
+		for i := 0; i < 20; i++ {
+			target := &PointOf[int16, string]{set: []int16{int16(r.Intn(2000) - 1000), int16(r.Intn(2000) - 1000)}}
+			want, got := KNN(tree, target, 3, nil), KNN(loaded, target, 3, nil)
+			for j := range want {
+				if !got[j].EqualTo(want[j]) || got[j].Data() != want[j].Data() {
+					t.Error(name, ` want: `, want[j], `
+		got: `, got[j])
+				}
+			}
+		}
+	}
+}
+
+func Test_TreeOf_WriteTo_Native_Width(t *testing.T) {
+	r := rand.New(rand.NewSource(26))
+	var small PointsOf[int8, interface{}]
+	var wide Datapoints
+	for i := 0; i < 200; i++ {
+		set := []int8{int8(r.Intn(256) - 128), int8(r.Intn(256) - 128), int8(r.Intn(256) - 128)}
+		small = append(small, NewPointOf[int8, interface{}](nil, set))
+		wide = append(wide, NewDatapoint(nil, []float64{float64(set[0]), float64(set[1]), float64(set[2])}))
+	}
+	var smallBuf, wideBuf bytes.Buffer
+	if _, err := Build(small, 0, MedianOf[int8, interface{}]()).WriteTo(&smallBuf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Build(wide, 0, Median).WriteTo(&wideBuf); err != nil {
+		t.Fatal(err)
+	}
+	if saved := wideBuf.Len() - smallBuf.Len(); saved != 200*3*7 {
+		t.Error(`want: `, 200*3*7, ` bytes fewer for int8 values
+		got: `, saved)
+	}
+
+	// values are converted to the coordinate type of the reader
+	var read TreeOf[int8, interface{}]
+	var widened Branch
+	if _, err := read.ReadFrom(bytes.NewReader(smallBuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := widened.ReadFrom(bytes.NewReader(smallBuf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 20; i++ {
+		set := []int8{int8(r.Intn(256) - 128), int8(r.Intn(256) - 128), int8(r.Intn(256) - 128)}
+		want := KNN(Build(small, 0, nil), NewPointOf[int8, interface{}](nil, set), 3, nil)
+		got := KNN(&read, NewPointOf[int8, interface{}](nil, set), 3, nil)
+		gotWide := KNN(&widened, NewDatapoint(nil, []float64{float64(set[0]), float64(set[1]), float64(set[2])}), 3, nil)
+		for j := range want {
+			if !got[j].EqualTo(want[j]) || gotWide[j].set[0] != float64(want[j].set[0]) {
+				t.Error(`want: `, want[j], `
+		got: `, got[j], ` and `, gotWide[j])
+			}
+		}
+	}
+
+	var halves bytes.Buffer
+	float32s := PointsOf[float32, interface{}]{NewPointOf[float32, interface{}](nil, []float32{0.1, 2.5})}
+	if _, err := Build(float32s, 0, nil).WriteTo(&halves); err != nil {
+		t.Fatal(err)
+	}
+	var loaded TreeOf[float32, interface{}]
+	if _, err := loaded.ReadFrom(&halves); err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Datapoints[0].set; got[0] != 0.1 || got[1] != 2.5 {
+		t.Error(`want: [0.1 2.5]
+		got: `, got)
+	}
+
+	var shorts bytes.Buffer
+	Build(PointsOf[int16, interface{}]{NewPointOf[int16, interface{}](nil, []int16{300})}, 0, nil).WriteTo(&shorts)
+	if _, err := read.ReadFrom(&shorts); !errors.Is(err, ErrFormat) {
+		t.Error(`want: `, ErrFormat, `
+		got: `, err)
+	}
+}
+
+func Test_TreeOf_ReadFrom_Rejects_Unrepresentable_Coordinates(t *testing.T) {
+	tree := Build(Datapoints{NewDatapoint(nil, []float64{1, 300}), NewDatapoint(nil, []float64{2, 2.5})}, 0, nil)
+	var buf bytes.Buffer
+	if _, err := tree.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var cells TreeOf[uint8, interface{}]
+	if _, err := cells.ReadFrom(&buf); !errors.Is(err, ErrFormat) {
+		t.Error(`want: `, ErrFormat, `
+		got: `, err)
+	}
+	if _, ok := toCoordinate[int8](-128); !ok {
+		t.Error(`want: -128 to be an int8`)
+	}
+	for _, v := range []float64{128, 2.5, -129} {
+		if _, ok := toCoordinate[int8](v); ok {
+			t.Error(`want: `, v, ` not to be an int8`)
+		}
+	}
+}
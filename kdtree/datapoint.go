@@ -3,48 +3,72 @@ package kdtree
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"sort"
+	"sync"
 )
 
-// Datapoint stores a set of floating-point values and a pointer to any other
-// structure or type which you may wish to associate with the Datapoint.
-type Datapoint struct {
-	data interface{} // ideally a pointer to some other associated thing
-	set  []float64
+// PointOf stores a set of coordinates of type C and the data of type T which you
+// may wish to associate with them. A TreeOf PointOfs hands back their data as T,
+// with no need for type assertions, and keeps their coordinates as C.
+type PointOf[C Coordinate, T any] struct {
+	data T
+	set  []C
 }
 
+// Point is the PointOf with floating-point values, as held by a Tree.
+type Point[T any] = PointOf[float64, T]
+
+// Datapoint stores a set of floating-point values and a pointer to any other
+// structure or type which you may wish to associate with the Datapoint. It is the
+// Point held by a Branch.
+type Datapoint = Point[interface{}]
+
+// PointsOf is a slice multiple of pointers to individual PointOfs.
+type PointsOf[C Coordinate, T any] []*PointOf[C, T]
+
 // Datapoints is a slice multiple of pointers to individual Datapoints
-type Datapoints []*Datapoint
+type Datapoints = PointsOf[float64, interface{}]
 
-// NewDatapoint is an explicit constructor as an alternative to manual declaration
-func NewDatapoint(data interface{}, points []float64) *Datapoint {
-	if points == nil {
-		points = []float64{}
+// NewPointOf returns the PointOf linking data with a copy of the coordinates.
+func NewPointOf[C Coordinate, T any](data T, coords []C) *PointOf[C, T] {
+	if coords == nil {
+		coords = []C{}
 	}
-	f := make([]float64, len(points), len(points))
-	copy(f, points)
-	d := Datapoint{
+	f := make([]C, len(coords), len(coords))
+	copy(f, coords)
+	d := PointOf[C, T]{
 		data: data,
 		set:  f,
 	}
 	return &d
 }
 
-// Data returns the interface value of the object that the Datapoint is linked with.
-func (d *Datapoint) Data() interface{} {
+// NewPoint returns the Point linking data with a copy of the floating-point values.
+func NewPoint[T any](data T, points []float64) *Point[T] {
+	return NewPointOf(data, points)
+}
+
+// NewDatapoint is an explicit constructor as an alternative to manual declaration
+func NewDatapoint(data interface{}, points []float64) *Datapoint {
+	return NewPoint(data, points)
+}
+
+// Data returns the value of the object that the Point is linked with.
+func (d *PointOf[C, T]) Data() T {
 	return d.data
 }
 
-// Set returns a copy of the slice of floating-point values
-func (d *Datapoint) Set() []float64 {
-	var export = make([]float64, len(d.set), len(d.set))
+// Set returns a copy of the slice of coordinates
+func (d *PointOf[C, T]) Set() []C {
+	var export = make([]C, len(d.set), len(d.set))
 	copy(export, d.set)
 	return export
 }
 
 // Dimensionality returns spatial dimensions the Datapoint fits over.
-func (d *Datapoint) Dimensionality() int {
+func (d *PointOf[C, T]) Dimensionality() int {
 	return len(d.set)
 }
 
@@ -70,7 +94,7 @@ func RandomDatapointInRange(n uint, min, max float64) *Datapoint {
 	return &d
 }
 
-func (d *Datapoint) setString() string {
+func (d *PointOf[C, T]) setString() string {
 	if d == nil {
 		return ""
 	}
@@ -83,12 +107,16 @@ func (d *Datapoint) setString() string {
 	return pointString
 }
 
-// String returns a formatted string presentation of the Datapoint object,
-// implementing Stringer interface
-// Bug – present, currently assumes data interface{} is a pointer and never a concrete type.
-func (d *Datapoint) String() string {
+// String returns a formatted string presentation of the Point object,
+// implementing Stringer interface. Data held by pointer is shown by the value it
+// points to; any other data, nil included, as it is.
+func (d *PointOf[C, T]) String() string {
 	var present string
-	present += fmt.Sprintf("{data: %v}, ", reflect.Indirect(reflect.ValueOf(d.data)))
+	var data interface{} = d.data
+	if v := reflect.ValueOf(data); v.Kind() == reflect.Pointer && !v.IsNil() {
+		data = v.Elem().Interface()
+	}
+	present += fmt.Sprintf("{data: %v}, ", data)
 	present += "{set: ["
 	for i := range d.set {
 		present += fmt.Sprintf("%d:{%v}, ", i, d.set[i])
@@ -136,8 +164,23 @@ func Comparator(plane int) By {
 	}
 }
 
-// EqualTo provides a direct equality comparison between two Datapoints
-func (d *Datapoint) EqualTo(q *Datapoint) bool {
+// axisSorter sorts PointOfs along axis, as By(Comparator(axis)) does Datapoints.
+type axisSorter[C Coordinate, T any] struct {
+	ds   PointsOf[C, T]
+	axis int
+}
+
+func (s *axisSorter[C, T]) Len() int           { return len(s.ds) }
+func (s *axisSorter[C, T]) Swap(i, j int)      { s.ds[i], s.ds[j] = s.ds[j], s.ds[i] }
+func (s *axisSorter[C, T]) Less(i, j int) bool { return s.ds[i].set[s.axis] < s.ds[j].set[s.axis] }
+
+// sortAlong sorts ds along axis.
+func sortAlong[C Coordinate, T any](ds PointsOf[C, T], axis int) {
+	sort.Sort(&axisSorter[C, T]{ds, axis})
+}
+
+// EqualTo provides a direct equality comparison between two Points
+func (d *PointOf[C, T]) EqualTo(q *PointOf[C, T]) bool {
 	if len(d.set) != len(q.set) {
 		return false
 	}
@@ -150,7 +193,7 @@ func (d *Datapoint) EqualTo(q *Datapoint) bool {
 }
 
 // EqualTo provides an equality comparison between each Datapoint in a set of Datapoints.
-func (ds Datapoints) EqualTo(qs Datapoints) bool {
+func (ds PointsOf[C, T]) EqualTo(qs PointsOf[C, T]) bool {
 	if len(ds) != len(qs) {
 		return false
 	}
@@ -163,14 +206,14 @@ func (ds Datapoints) EqualTo(qs Datapoints) bool {
 }
 
 // Import uses the Importable interface to cleanly append a single Datapoint to a the end of a set (slice) of Datapoints
-func (ds *Datapoints) Import(I Importable) {
+func (ds *PointsOf[C, T]) Import(I ImportableOf[C, T]) {
 	*ds = append(*ds, I.ToDatapoint())
 }
 
 // PointsSetString returns a concatenated presentation of each Datapoint set as a single set presentation.
 // e.g. `{(1,2) (3,4) (5,6) (7,8)}`
 // possibly should be internal only?
-func (ds *Datapoints) PointsSetString() string {
+func (ds *PointsOf[C, T]) PointsSetString() string {
 	pss := `{`
 	for _, d := range *ds {
 		if d == nil {
@@ -183,7 +226,36 @@ func (ds *Datapoints) PointsSetString() string {
 	return pss
 }
 
-func (ds Datapoints) notDistinct() bool {
+// Validate checks that a set of Datapoints can be built into a k-d tree: it must
+// not be empty, no Datapoint may be nil, every Datapoint must share the
+// dimensionality of the first, and no value may be NaN or ±Inf. The first
+// problem found is returned as ErrEmpty, a *NilDatapointError, a *DimClashError
+// or a *NonFiniteError.
+func (ds PointsOf[C, T]) Validate() error {
+	if len(ds) == 0 {
+		return ErrEmpty
+	}
+	dimensionality := -1
+	for i, d := range ds {
+		if d == nil {
+			return &NilDatapointError{Index: i}
+		}
+		if dimensionality < 0 {
+			dimensionality = len(d.set)
+		}
+		if len(d.set) != dimensionality {
+			return &DimClashError{Index: i, Want: dimensionality, Got: len(d.set)}
+		}
+		for axis, v := range d.set {
+			if f := float64(v); math.IsNaN(f) || math.IsInf(f, 0) {
+				return &NonFiniteError{Index: i, Axis: axis, Value: f}
+			}
+		}
+	}
+	return nil
+}
+
+func (ds PointsOf[C, T]) notDistinct() bool {
 	sz := len(ds)
 	if sz <= 1 {
 		return false
@@ -198,13 +270,83 @@ func (ds Datapoints) notDistinct() bool {
 }
 
 // MarshalJSON implements encoding/json Marshaler interface
-func (d *Datapoint) MarshalJSON() ([]byte, error) {
+func (d *PointOf[C, T]) MarshalJSON() ([]byte, error) {
 	return json.Marshal(map[string]interface{}{
 		"data": d.data,
 		"set":  d.set,
 	})
 }
 
-// TODO: Implement encoding/json Unmarshaler interface method
-// func (d *Datapoint) UnmarshalJSON([]byte) error {
-// }
+// UnmarshalJSON implements encoding/json Unmarshaler interface, reading the form
+// written by MarshalJSON. The data payload of a Datapoint is passed to the
+// DataDecoder set by RegisterDataDecoder, or decoded as a generic JSON value if
+// none is set; that of any other Point is decoded into its type T.
+func (d *PointOf[C, T]) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Data json.RawMessage `json:"data"`
+		Set  []C             `json:"set"`
+	}
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	data, err := decodePayload[T](raw.Data)
+	if err != nil {
+		return err
+	}
+	if raw.Set == nil {
+		raw.Set = []C{}
+	}
+	d.data, d.set = data, raw.Set
+	return nil
+}
+
+// DataDecoder reconstructs the data payload of a Datapoint from the JSON it was
+// marshalled to, so that unmarshalled Datapoints can link to typed values.
+type DataDecoder func(json.RawMessage) (interface{}, error)
+
+var (
+	dataDecoderMu sync.RWMutex
+	dataDecoder   DataDecoder
+)
+
+// RegisterDataDecoder sets the DataDecoder used for every data payload unmarshalled
+// from then on, by Datapoint or Branch. Passing nil restores generic decoding into
+// the types used by encoding/json for an interface{} value.
+// A null payload is always decoded as nil, without calling the DataDecoder.
+func RegisterDataDecoder(dec DataDecoder) {
+	dataDecoderMu.Lock()
+	defer dataDecoderMu.Unlock()
+	dataDecoder = dec
+}
+
+// decodePayload decodes the data payload of a PointOf from the JSON it was
+// marshalled to: by decodeData for a Datapoint, and into T for any other.
+func decodePayload[T any](raw json.RawMessage) (T, error) {
+	var data T
+	if untyped, ok := interface{}(&data).(*interface{}); ok {
+		decoded, err := decodeData(raw)
+		*untyped = decoded
+		return data, err
+	}
+	if len(raw) > 0 {
+		if err := json.Unmarshal(raw, &data); err != nil {
+			return data, err
+		}
+	}
+	return data, nil
+}
+
+func decodeData(raw json.RawMessage) (interface{}, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, nil
+	}
+	dataDecoderMu.RLock()
+	dec := dataDecoder
+	dataDecoderMu.RUnlock()
+	if dec != nil {
+		return dec(raw)
+	}
+	var data interface{}
+	err := json.Unmarshal(raw, &data)
+	return data, err
+}
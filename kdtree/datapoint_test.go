@@ -146,7 +146,8 @@ func Test_Datapoint_Dimensionality(t *testing.T) {
 
 func Test_Datapoint_Stringer(t *testing.T) {
 	dpStringStr := `{data: cassandra}, {set: [0:{6.0000125}, 1:{6.10000125}, 2:{-1.3173}, 3:{1373}]}`
-	dpRationalStr := `{data: &{{false [5]} {false [4]}}}, {set: [0:{1}, 1:{2}, 2:{3}, 3:{4}, 4:{5}]}`
+	dpRationalStr := `{data: 5/4}, {set: [0:{1}, 1:{2}, 2:{3}, 3:{4}, 4:{5}]}`
+	var nilString *string
 	var stringerTests = []struct {
 		dp   *Datapoint
 		want string
@@ -165,6 +166,9 @@ func Test_Datapoint_Stringer(t *testing.T) {
 			},
 			dpRationalStr,
 		},
+		{&Datapoint{nil, []float64{1}}, `{data: <nil>}, {set: [0:{1}]}`},
+		{&Datapoint{42, []float64{1}}, `{data: 42}, {set: [0:{1}]}`},
+		{&Datapoint{nilString, []float64{1}}, `{data: <nil>}, {set: [0:{1}]}`},
 	}
 
 	for _, s := range stringerTests {
@@ -295,3 +299,62 @@ func Test_Datapoints_Import_with_Importable_Interface(t *testing.T) {
 		}
 	}
 }
+
+func Test_Datapoint_UnmarshalJSON(t *testing.T) {
+	for _, ct := range constructorInputs {
+		dpJSON, err := json.Marshal(NewDatapoint(ct.linked, ct.values))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Datapoint
+		if err := json.Unmarshal(dpJSON, &got); err != nil {
+			t.Fatal(err)
+		}
+		if reflect.DeepEqual(got.set, ct.values) == false {
+			t.Error(`want: `, ct.values, `
+			got: `, got.set)
+		}
+		roundTrip, _ := json.Marshal(&got)
+		if string(roundTrip) != string(dpJSON) {
+			t.Error(`want: `, string(dpJSON), `
+			got: `, string(roundTrip))
+		}
+	}
+
+	var empty Datapoint
+	if err := json.Unmarshal([]byte(`{"data":null,"set":null}`), &empty); err != nil {
+		t.Fatal(err)
+	}
+	if empty.data != nil || empty.set == nil || empty.Dimensionality() != 0 {
+		t.Error(`want: nil data and an empty set
+			got: `, empty.data, empty.set)
+	}
+}
+
+func Test_Datapoint_RegisterDataDecoder(t *testing.T) {
+	defer RegisterDataDecoder(nil)
+	RegisterDataDecoder(func(raw json.RawMessage) (interface{}, error) {
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return nil, err
+		}
+		return &s, nil
+	})
+
+	var got Datapoint
+	if err := json.Unmarshal([]byte(`{"data":"cassandra","set":[1]}`), &got); err != nil {
+		t.Fatal(err)
+	}
+	if s, ok := got.Data().(*string); !ok || *s != str {
+		t.Error(`want: *string `, str, `
+			got: `, reflect.TypeOf(got.Data()), got.Data())
+	}
+
+	if err := json.Unmarshal([]byte(`{"data":7,"set":[1]}`), &got); err == nil {
+		t.Error(`want: error from the DataDecoder`)
+	}
+	if err := json.Unmarshal([]byte(`{"data":null,"set":[1]}`), &got); err != nil || got.Data() != nil {
+		t.Error(`want: nil data without calling the DataDecoder
+			got: `, got.Data(), err)
+	}
+}
@@ -0,0 +1,150 @@
+package kdtree
+
+import "reflect"
+
+// Delete removes a single Datapoint matching d from the k-d tree, reporting whether
+// one was found. A Datapoint matches if it is d itself, or if it is EqualTo d and
+// either d has no data payload or both hold the identical payload.
+// The Datapoint is tombstoned rather than unlinked, so it stays in its leaf but is
+// skipped by every query, until compaction rebuilds the subtree without it: Delete
+// compacts the highest branch on the path to the deleted Datapoint whose share of
+// tombstones is above the CompactionThreshold the tree was built with.
+func (branch *TreeOf[C, T]) Delete(d *PointOf[C, T]) bool {
+	if branch == nil || d == nil {
+		return false
+	}
+	_, ok := branch.delete(d, false)
+	return ok
+}
+
+// delete tombstones a Datapoint matching d below branch, and returns the branch
+// to use in its place. With cow set, no existing branch is modified, as for insert.
+func (branch *TreeOf[C, T]) delete(d *PointOf[C, T], cow bool) (*TreeOf[C, T], bool) {
+	b := branch
+	for !b.isLeaf() {
+		near, _ := b.split(d)
+		b = near
+	}
+	i := b.find(d)
+	if i < 0 {
+		return branch, false
+	}
+
+	root := branch.own(cow)
+	path := []*TreeOf[C, T]{root}
+	for b = root; !b.isLeaf(); {
+		b = b.ownChild(d, cow)
+		path = append(path, b)
+	}
+	tombstoned := make([]bool, len(b.Datapoints), len(b.Datapoints))
+	copy(tombstoned, b.tombstoned)
+	tombstoned[i] = true
+	b.tombstoned = tombstoned
+	retally(path)
+
+	threshold := root.options().CompactionThreshold
+	for i, p := range path {
+		if p.overThreshold(threshold) {
+			p.rebuild()
+			retally(path[:i])
+			break
+		}
+	}
+	return root, true
+}
+
+// Compact rebuilds every subtree whose share of tombstoned Datapoints is above
+// the CompactionThreshold the tree was built with, so that they no longer take up
+// memory or query time. For a tree never compacted on Delete, with a threshold of
+// 1 or more, it rebuilds every subtree holding any tombstones.
+func (branch *TreeOf[C, T]) Compact() {
+	branch.compact(false)
+}
+
+// compact is Compact, returning the branch to use in place of the original.
+// With cow set, no existing branch is modified, as for insert.
+func (branch *TreeOf[C, T]) compact(cow bool) *TreeOf[C, T] {
+	if branch == nil {
+		return nil
+	}
+	threshold := branch.options().CompactionThreshold
+	if threshold >= 1 {
+		threshold = 0
+	}
+	return branch.compactAbove(threshold, cow)
+}
+
+func (branch *TreeOf[C, T]) compactAbove(threshold float64, cow bool) *TreeOf[C, T] {
+	if branch == nil || branch.dead == 0 {
+		return branch
+	}
+	b := branch.own(cow)
+	if b.overThreshold(threshold) {
+		b.rebuild()
+		return b
+	}
+	b.left = b.left.compactAbove(threshold, cow)
+	b.right = b.right.compactAbove(threshold, cow)
+	b.tally()
+	return b
+}
+
+func (branch *TreeOf[C, T]) overThreshold(threshold float64) bool {
+	return branch.dead > 0 && float64(branch.dead) > threshold*float64(branch.count+branch.dead)
+}
+
+// find returns the index in a leaf of the first live Datapoint matching d, or -1.
+func (branch *TreeOf[C, T]) find(d *PointOf[C, T]) int {
+	for i, p := range branch.Datapoints {
+		if p == nil || branch.isTombstoned(i) {
+			continue
+		}
+		if p == d || (p.EqualTo(d) && (any(d.data) == nil || samePayload(p.data, d.data))) {
+			return i
+		}
+	}
+	return -1
+}
+
+// isTombstoned reports whether the i-th Datapoint of a leaf has been deleted.
+func (branch *TreeOf[C, T]) isTombstoned(i int) bool {
+	return i < len(branch.tombstoned) && branch.tombstoned[i]
+}
+
+// live returns the Datapoints in the leaves under branch which have not been deleted.
+func (branch *TreeOf[C, T]) live() PointsOf[C, T] {
+	if branch == nil {
+		return nil
+	}
+	if !branch.isLeaf() {
+		return append(branch.left.live(), branch.right.live()...)
+	}
+	var live PointsOf[C, T]
+	for i, d := range branch.Datapoints {
+		if d != nil && !branch.isTombstoned(i) {
+			live = append(live, d)
+		}
+	}
+	return live
+}
+
+// samePayload reports whether a and b hold the identical value. Maps and slices
+// are identical when they share the same underlying storage; payloads of any other
+// incomparable type are never considered identical.
+func samePayload(a, b interface{}) bool {
+	ta := reflect.TypeOf(a)
+	if ta == nil || ta != reflect.TypeOf(b) {
+		return false
+	}
+	switch ta.Kind() {
+	case reflect.Map:
+		return reflect.ValueOf(a).Pointer() == reflect.ValueOf(b).Pointer()
+	case reflect.Slice:
+		va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+		return va.Pointer() == vb.Pointer() && va.Len() == vb.Len()
+	}
+	if !ta.Comparable() {
+		return false
+	}
+	return a == b
+}
@@ -0,0 +1,176 @@
+package kdtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_Delete_Queries_Skip_Tombstones(t *testing.T) {
+	for _, threshold := range []float64{1, 0.5, 0.1} {
+		var ds Datapoints
+		for i := 0; i < 600; i++ {
+			ds = append(ds, RandomDatapointInRange(2, 0, 100))
+		}
+		tree := BuildWith(append(Datapoints{}, ds...), 0, BuildOptions{Pivot: Median, CompactionThreshold: threshold})
+
+		deleted := map[*Datapoint]bool{}
+		var remaining Datapoints
+		for _, i := range rand.Perm(len(ds)) {
+			if len(deleted) < 400 {
+				if !tree.Delete(ds[i]) {
+					t.Error(`failed to delete `, ds[i])
+				}
+				deleted[ds[i]] = true
+			} else {
+				remaining = append(remaining, ds[i])
+			}
+		}
+
+		if got := tree.size(); got != len(remaining) {
+			t.Error(`want: `, len(remaining), `
+		got: `, got)
+		}
+		for i := 0; i < 50; i++ {
+			target := RandomDatapointInRange(2, 0, 100)
+			got := KNN(tree, target, 5, nil)
+			want := bruteForceKNN(remaining, target, 5)
+			if !sameDistances(target, got, want) {
+				t.Error(`threshold = `, threshold, `
+		want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+			}
+			if nearest, _ := NN(tree, target, nil); deleted[nearest] {
+				t.Error(`NN returned deleted `, nearest)
+			}
+			if approx := ANN(tree, target, nil); approx == nil || deleted[approx] {
+				t.Error(`ANN returned `, approx)
+			}
+			for _, d := range RadiusQuery(tree, target, 10, nil) {
+				if deleted[d] {
+					t.Error(`RadiusQuery returned deleted `, d)
+				}
+			}
+		}
+	}
+}
+
+func Test_Delete_Matching(t *testing.T) {
+	a, b := "a", "b"
+	pa := &Datapoint{&a, []float64{1, 1}}
+	pb := &Datapoint{&b, []float64{1, 1}}
+	ds := Datapoints{
+		&Datapoint{nil, []float64{0, 0}},
+		pa,
+		pb,
+		&Datapoint{nil, []float64{3, 3}},
+		&Datapoint{mappy, []float64{4, 4}},
+	}
+	tree := Build(append(Datapoints{}, ds...), 0, Median)
+
+	if tree.Delete(&Datapoint{nil, []float64{2, 2}}) {
+		t.Error(`deleted a Datapoint which is not in the tree`)
+	}
+	if tree.Delete(&Datapoint{&a, []float64{0, 0}}) {
+		t.Error(`deleted a Datapoint by payload alone`)
+	}
+	if tree.Delete(&Datapoint{map[string]interface{}{}, []float64{4, 4}}) { // incomparable payloads must not panic
+		t.Error(`deleted (4, 4) holding a different map`)
+	}
+	if !tree.Delete(&Datapoint{mappy, []float64{4, 4}}) {
+		t.Error(`failed to delete (4, 4) by its map payload`)
+	}
+	if !tree.Delete(&Datapoint{&b, []float64{1, 1}}) {
+		t.Error(`failed to delete (1, 1) by payload`)
+	}
+	got := RadiusQuery(tree, &Datapoint{nil, []float64{1, 1}}, 0, nil)
+	if len(got) != 1 || got[0] != pa {
+		t.Error(`want: `, pa, `
+		got: `, got)
+	}
+	if !tree.Delete(pa) || tree.Delete(pa) {
+		t.Error(`want: one successful Delete of the same Datapoint`)
+	}
+	if got := tree.size(); got != 2 {
+		t.Error(`want: 2
+		got: `, got)
+	}
+}
+
+func Test_Delete_Compaction(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 256; i++ {
+		ds = append(ds, &Datapoint{nil, []float64{float64(i), float64(i % 16)}})
+	}
+	tree := BuildWith(append(Datapoints{}, ds...), 0, BuildOptions{Pivot: Median, CompactionThreshold: 1})
+	for _, d := range ds[:192] {
+		tree.Delete(d)
+	}
+	if tree.dead != 192 || tree.size() != 64 {
+		t.Error(`want: 192 tombstones and 64 live
+		got: `, tree.dead, ` and `, tree.size())
+	}
+
+	tree.Compact()
+	if tree.dead != 0 || tree.size() != 64 {
+		t.Error(`want: 0 tombstones and 64 live
+		got: `, tree.dead, ` and `, tree.size())
+	}
+	got, want := byIdentity(tree.live()), ds[192:]
+	if !got.EqualTo(want) {
+		t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+	}
+
+	for _, d := range ds[192:] {
+		tree.Delete(d)
+	}
+	if got := ANN(tree, ds[0], nil); got != nil {
+		t.Error(`want: nil from an empty tree
+		got: `, got)
+	}
+	tree.Insert(ds[0])
+	if got := ANN(tree, ds[1], nil); got != ds[0] {
+		t.Error(`want: `, ds[0], `
+		got: `, got)
+	}
+}
+
+func Test_Delete_CompactionThreshold_Per_Tree(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 256; i++ {
+		ds = append(ds, &Datapoint{nil, []float64{float64(i), float64(i % 16)}})
+	}
+	compacting := BuildWith(append(Datapoints{}, ds...), 0, BuildOptions{Pivot: Median})
+	lazy := BuildWith(append(Datapoints{}, ds...), 0, BuildOptions{Pivot: Median, CompactionThreshold: 1})
+	for _, d := range ds[:192] {
+		compacting.Delete(d)
+		lazy.Delete(d)
+	}
+	if compacting.dead >= 192 || lazy.dead != 192 {
+		t.Error(`want: fewer than 192 and exactly 192 tombstones
+		got: `, compacting.dead, ` and `, lazy.dead)
+	}
+	if compacting.size() != 64 || lazy.size() != 64 {
+		t.Error(`want: 64 live in both
+		got: `, compacting.size(), ` and `, lazy.size())
+	}
+}
+
+func Test_Delete_RangeQuery_Skips_Tombstones(t *testing.T) {
+	ds := make(Datapoints, len(dps3))
+	copy(ds, dps3)
+	tree := Build(ds, 0, Median)
+	bounds := []Range{Closed(0, 10), Closed(0, 10)}
+
+	tree.Delete(&Datapoint{nil, []float64{5, 4}})
+	got := RangeQuery(tree, bounds)
+	if len(got) != len(dps3)-1 {
+		t.Error(`want: `, len(dps3)-1, `
+		got: `, got.PointsSetString())
+	}
+	for _, d := range got {
+		if d.EqualTo(&Datapoint{nil, []float64{5, 4}}) {
+			t.Error(`RangeQuery returned deleted (5, 4)`)
+		}
+	}
+}
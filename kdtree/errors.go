@@ -0,0 +1,77 @@
+package kdtree
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned, directly or wrapped, when building a k-d tree.
+var (
+	// ErrEmpty is returned when there are no Datapoints to build a tree from.
+	ErrEmpty = errors.New("kdtree: no Datapoints to build from")
+
+	// ErrDimClash is matched by every *DimClashError.
+	ErrDimClash = errors.New("kdtree: Datapoints of inconsistent dimensionality")
+
+	// ErrNilDatapoint is matched by every *NilDatapointError.
+	ErrNilDatapoint = errors.New("kdtree: nil Datapoint")
+
+	// ErrNonFinite is matched by every *NonFiniteError.
+	ErrNonFinite = errors.New("kdtree: Datapoint has a NaN or infinite value")
+
+	// ErrFormat is wrapped by every error ReadFrom returns for input which is not
+	// a valid tree, as written by WriteTo.
+	ErrFormat = errors.New("kdtree: malformed binary tree")
+
+	// ErrVersion is wrapped by the error ReadFrom returns for input written in a
+	// later format than this package is able to read.
+	ErrVersion = errors.New("kdtree: unsupported binary tree version")
+)
+
+// DimClashError reports the first Datapoint whose dimensionality differs from
+// that of the first Datapoint in the set.
+type DimClashError struct {
+	Index     int // position of the offending Datapoint
+	Want, Got int // dimensionality of the first and of the offending Datapoint
+}
+
+func (e *DimClashError) Error() string {
+	return fmt.Sprintf("kdtree: Datapoint %d has dimensionality %d, want %d", e.Index, e.Got, e.Want)
+}
+
+// Is makes errors.Is(err, ErrDimClash) hold for any *DimClashError.
+func (e *DimClashError) Is(target error) bool {
+	return target == ErrDimClash
+}
+
+// NonFiniteError reports the first Datapoint with a NaN or ±Inf value, which
+// cannot be ordered against a pivot.
+type NonFiniteError struct {
+	Index int     // position of the offending Datapoint
+	Axis  int     // axis of the offending value
+	Value float64 // the NaN or ±Inf value itself
+}
+
+func (e *NonFiniteError) Error() string {
+	return fmt.Sprintf("kdtree: Datapoint %d has value %v on axis %d", e.Index, e.Value, e.Axis)
+}
+
+// Is makes errors.Is(err, ErrNonFinite) hold for any *NonFiniteError.
+func (e *NonFiniteError) Is(target error) bool {
+	return target == ErrNonFinite
+}
+
+// NilDatapointError reports the first nil Datapoint in the set, such as one
+// returned by an Importable's ToDatapoint.
+type NilDatapointError struct {
+	Index int // position of the nil Datapoint
+}
+
+func (e *NilDatapointError) Error() string {
+	return fmt.Sprintf("kdtree: Datapoint %d is nil", e.Index)
+}
+
+// Is makes errors.Is(err, ErrNilDatapoint) hold for any *NilDatapointError.
+func (e *NilDatapointError) Is(target error) bool {
+	return target == ErrNilDatapoint
+}
@@ -0,0 +1,237 @@
+package kdtree
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// ForestOptions controls how NewForest and NewForestOf build their trees.
+type ForestOptions struct {
+	// Trees is the number of trees in the forest; 4 if less than 1.
+	Trees int
+
+	// TopAxes is the number of axes of highest variance among which each split
+	// picks one at random; 5 if less than 1.
+	TopAxes int
+
+	// Rotate builds each tree over its own random rotation of the Datapoints, so
+	// that the trees split along different directions even where only a few axes
+	// vary much. Only a metric which rotations preserve, such as Euclidean, may
+	// then be used to search the Forest. Rotated values are held as float64, so a
+	// ForestOf any other coordinates is then searched under Euclidean whatever
+	// metric it is given.
+	Rotate bool
+
+	// LeafSize is the most Datapoints kept together in a leaf of each tree, as
+	// in BuildOptions.
+	LeafSize int
+
+	// Seed seeds the random choices, so that the same options build the same Forest.
+	Seed int64
+}
+
+// ForestOf is a set of randomized k-d trees over the same PointOfs, searched
+// together for approximate nearest neighbours. Where a single tree, such as Build
+// makes, must visit nearly every node to find the nearest neighbours of a target
+// in many dimensions, trees which split differently seldom all fail to hold the
+// nearest neighbours close to the target, so searching them together finds more
+// of them for the same number of leaf checks.
+// A ForestOf is never modified once built, so it can be searched by any number of
+// goroutines at once.
+type ForestOf[C Coordinate, T any] struct {
+	trees     []*TreeOf[C, T]
+	rotated   []*TreeOf[float64, *PointOf[C, T]] // if Rotate, the trees in its place, over rotations of the PointOfs
+	rotations [][][]float64                      // the rotation of each rotated tree's PointOfs
+}
+
+// Forest is the ForestOf Datapoints.
+type Forest = ForestOf[float64, interface{}]
+
+// varianceSample is the most Datapoints whose variance along each axis is
+// measured to rank the axes of a split.
+const varianceSample = 100
+
+// NewForest builds a Forest over a set of assumed to be valid Datapoints OF
+// CONSISTENT DIMENSIONALITY, as set out by opts. Every tree splits at the median,
+// each time along one of the axes of highest variance picked at random.
+func NewForest(ds Datapoints, opts ForestOptions) *Forest {
+	return NewForestOf(ds, opts)
+}
+
+// NewForestOf builds a ForestOf over a set of assumed to be valid PointOfs OF
+// CONSISTENT DIMENSIONALITY, as NewForest does over Datapoints.
+func NewForestOf[C Coordinate, T any](ds PointsOf[C, T], opts ForestOptions) *ForestOf[C, T] {
+	if opts.Trees < 1 {
+		opts.Trees = 4
+	}
+	if opts.TopAxes < 1 {
+		opts.TopAxes = 5
+	}
+	r := rand.New(rand.NewSource(opts.Seed))
+
+	f := &ForestOf[C, T]{}
+	if opts.Rotate && len(ds) > 0 {
+		f.rotated = make([]*TreeOf[float64, *PointOf[C, T]], opts.Trees, opts.Trees)
+		f.rotations = make([][][]float64, opts.Trees, opts.Trees)
+		for i := range f.rotated {
+			f.rotations[i] = randomRotation(len(ds[0].set), r)
+			set := make(PointsOf[float64, *PointOf[C, T]], len(ds), len(ds))
+			for j, d := range ds {
+				set[j] = &PointOf[float64, *PointOf[C, T]]{d, rotate(f.rotations[i], d.set)}
+			}
+			f.rotated[i] = BuildWith(set, 0, BuildOptionsOf[float64, *PointOf[C, T]]{
+				Pivot:    QuickMedianOf[float64, *PointOf[C, T]](),
+				Axis:     randomTopAxis[float64, *PointOf[C, T]](opts.TopAxes, r),
+				LeafSize: opts.LeafSize,
+			})
+		}
+		return f
+	}
+	f.trees = make([]*TreeOf[C, T], opts.Trees, opts.Trees)
+	for i := range f.trees {
+		f.trees[i] = BuildWith(ds, 0, BuildOptionsOf[C, T]{
+			Pivot:    QuickMedianOf[C, T](),
+			Axis:     randomTopAxis[C, T](opts.TopAxes, r),
+			LeafSize: opts.LeafSize,
+		})
+	}
+	return f
+}
+
+// NN returns the nearest-neighbouring Datapoint to target found in the Forest
+// under metric (Euclidean if nil), along with the number of nodes examined, as
+// KNN does for k of 1.
+func (f *ForestOf[C, T]) NN(target *PointOf[C, T], checks int, metric MetricOf[C]) (*PointOf[C, T], int) {
+	nearest, examined := f.KNN(target, 1, checks, metric)
+	if len(nearest) == 0 {
+		return nil, examined
+	}
+	return nearest[0], examined
+}
+
+// KNN returns the k nearest-neighbouring Datapoints to target found in the Forest
+// under metric (Euclidean if nil), ordered by ascending distance, along with the
+// number of nodes examined. The trees are searched best bin first, as by BBFKNN,
+// but all together: the search always resumes from whichever subtree of any tree
+// is nearest to target, until it has checked the given number of leaves between
+// them, or all of them if checks is 0 or less.
+// More trees and more checks each find more of the true nearest neighbours, at
+// the cost of memory and time respectively.
+func (f *ForestOf[C, T]) KNN(target *PointOf[C, T], k, checks int, metric MetricOf[C]) (PointsOf[C, T], int) {
+	if k <= 0 {
+		return nil, 0
+	}
+	if f.rotated != nil {
+		return f.rotatedKNN(target, k, checks, metric)
+	}
+	if metric == nil {
+		metric = EuclideanOf[C]()
+	}
+	seen := map[*PointOf[C, T]]bool{}
+	s := bbfSearch[C, T]{k: k, checks: checks, metric: metric, found: make(neighbourHeap[C, T], 0, k)}
+	s.seen = func(d *PointOf[C, T]) bool {
+		offered := seen[d]
+		seen[d] = true
+		return offered
+	}
+	for _, tree := range f.trees {
+		s.push(tree, target)
+	}
+	s.run()
+	return s.found.sorted(), s.examined
+}
+
+// rotatedKNN is KNN over the rotated trees, whose values are float64 whatever C
+// is. They are searched under metric if it is a Metric, and otherwise under
+// Euclidean: the only metric rotations preserve, up to scale, so the one which
+// ranks neighbours as any metric allowed for a rotated ForestOf does.
+func (f *ForestOf[C, T]) rotatedKNN(target *PointOf[C, T], k, checks int, metric MetricOf[C]) (PointsOf[C, T], int) {
+	rotatedMetric, ok := interface{}(metric).(Metric)
+	if !ok {
+		rotatedMetric = Euclidean
+	}
+	seen := map[*PointOf[C, T]]bool{}
+	s := bbfSearch[float64, *PointOf[C, T]]{k: k, checks: checks, metric: rotatedMetric, found: make(neighbourHeap[float64, *PointOf[C, T]], 0, k)}
+	s.seen = func(d *PointOf[float64, *PointOf[C, T]]) bool {
+		offered := seen[d.data]
+		seen[d.data] = true
+		return offered
+	}
+	for i, tree := range f.rotated {
+		s.push(tree, &PointOf[float64, *PointOf[C, T]]{target, rotate(f.rotations[i], target.set)})
+	}
+	s.run()
+	found := s.found.sorted()
+	nearest := make(PointsOf[C, T], len(found), len(found))
+	for i, d := range found {
+		nearest[i] = d.data
+	}
+	return nearest, s.examined
+}
+
+// randomTopAxis returns an AxisFuncOf which picks at random among the top axes of
+// highest variance, measured over a sample of the PointOfs.
+func randomTopAxis[C Coordinate, T any](top int, r *rand.Rand) AxisFuncOf[C, T] {
+	return func(ds PointsOf[C, T], depth int) int {
+		sample := ds
+		if len(ds) > varianceSample {
+			sample = make(PointsOf[C, T], varianceSample, varianceSample)
+			for i := range sample {
+				sample[i] = ds[i*len(ds)/varianceSample]
+			}
+		}
+		axes := make([]int, len(ds[0].set), len(ds[0].set))
+		variances := make([]float64, len(axes), len(axes))
+		for axis := range axes {
+			axes[axis], variances[axis] = axis, variance(sample, axis)
+		}
+		sort.SliceStable(axes, func(i, j int) bool { return variances[axes[i]] > variances[axes[j]] })
+		return axes[r.Intn(min(top, len(axes)))]
+	}
+}
+
+// randomRotation returns a uniformly random rotation of n dimensions, as the rows
+// of an orthonormal matrix, by Gram-Schmidt orthonormalisation of Gaussian vectors.
+func randomRotation(n int, r *rand.Rand) [][]float64 {
+	rows := make([][]float64, 0, n)
+	for len(rows) < n {
+		v := make([]float64, n, n)
+		for i := range v {
+			v[i] = r.NormFloat64()
+		}
+		for _, u := range rows {
+			var dot float64
+			for i := range v {
+				dot += v[i] * u[i]
+			}
+			for i := range v {
+				v[i] -= dot * u[i]
+			}
+		}
+		var norm float64
+		for _, x := range v {
+			norm += x * x
+		}
+		norm = math.Sqrt(norm)
+		if norm < 1e-9 { // all but parallel to the rows so far; draw again
+			continue
+		}
+		for i := range v {
+			v[i] /= norm
+		}
+		rows = append(rows, v)
+	}
+	return rows
+}
+
+// rotate returns set multiplied by the rotation.
+func rotate[C Coordinate](rotation [][]float64, set []C) []float64 {
+	out := make([]float64, len(rotation), len(rotation))
+	for i, row := range rotation {
+		for j, x := range row {
+			out[i] += x * float64(set[j])
+		}
+	}
+	return out
+}
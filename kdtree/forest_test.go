@@ -0,0 +1,142 @@
+package kdtree
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func Test_Forest_Unlimited_Is_Exact(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(4, -50, 50))
+	}
+	given := map[*Datapoint]bool{}
+	for _, d := range ds {
+		given[d] = true
+	}
+	for _, rotate := range []bool{false, true} {
+		f := NewForest(ds, ForestOptions{Trees: 3, TopAxes: 2, Rotate: rotate, LeafSize: 4, Seed: 23})
+		for i := 0; i < 30; i++ {
+			target := RandomDatapointInRange(4, -60, 60)
+			want := bruteForceKNN(ds, target, 8)
+			got, _ := f.KNN(target, 8, 0, nil)
+			if !sameDistances(target, got, want) {
+				t.Error(`rotate `, rotate, ` want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+			}
+			for _, d := range got {
+				if !given[d] {
+					t.Error(`rotate `, rotate, `: a rotated Datapoint escaped the Forest`)
+				}
+			}
+		}
+	}
+}
+
+func Test_Forest_Recall_In_Many_Dimensions(t *testing.T) {
+	r := rand.New(rand.NewSource(23))
+	random := func() *Datapoint {
+		set := make([]float64, 64)
+		for axis := range set {
+			set[axis] = r.Float64()
+		}
+		return &Datapoint{nil, set}
+	}
+	var ds Datapoints
+	for i := 0; i < 2000; i++ {
+		ds = append(ds, random())
+	}
+	const k, checks = 5, 40
+	var targets Datapoints
+	wants := map[*Datapoint]map[*Datapoint]bool{}
+	for i := 0; i < 40; i++ {
+		target := random()
+		targets = append(targets, target)
+		wants[target] = map[*Datapoint]bool{}
+		for _, d := range bruteForceKNN(ds, target, k) {
+			wants[target][d] = true
+		}
+	}
+
+	recall := func(search func(target *Datapoint) Datapoints) int {
+		found := 0
+		for _, target := range targets {
+			want := wants[target]
+			got := search(target)
+			if len(got) != k {
+				t.Fatal(`want: `, k, ` candidates
+		got: `, len(got))
+			}
+			for _, d := range got {
+				if want[d] {
+					found++
+				}
+			}
+		}
+		return found
+	}
+
+	single := NewForest(ds, ForestOptions{Trees: 1, LeafSize: 8, Seed: 1})
+	many := NewForest(ds, ForestOptions{Trees: 8, LeafSize: 8, Seed: 1})
+	rotatedMany := NewForest(ds, ForestOptions{Trees: 8, Rotate: true, LeafSize: 8, Seed: 1})
+	fewer := recall(func(target *Datapoint) Datapoints { got, _ := single.KNN(target, k, checks, nil); return got })
+	more := recall(func(target *Datapoint) Datapoints { got, _ := many.KNN(target, k, checks, nil); return got })
+	moreRotated := recall(func(target *Datapoint) Datapoints { got, _ := rotatedMany.KNN(target, k, checks, nil); return got })
+	moreChecks := recall(func(target *Datapoint) Datapoints { got, _ := many.KNN(target, k, 4*checks, nil); return got })
+	if more <= fewer || moreRotated <= fewer || moreChecks <= more {
+		t.Error(`of `, k*len(targets), ` nearest neighbours found `, fewer, ` with 1 tree, `, more, ` with 8, `,
+			moreRotated, ` with 8 rotated, and `, moreChecks, ` with 8 and more checks`)
+	}
+}
+
+func Test_ForestOf_Float32(t *testing.T) {
+	r := rand.New(rand.NewSource(24))
+	var ps PointsOf[float32, int]
+	for i := 0; i < 400; i++ {
+		ps = append(ps, NewPointOf(i, []float32{r.Float32(), r.Float32(), r.Float32(), r.Float32()}))
+	}
+	for _, rotate := range []bool{false, true} {
+		for _, metric := range []MetricOf[float32]{nil, EuclideanOf[float32]()} {
+			f := NewForestOf(ps, ForestOptions{Trees: 3, TopAxes: 2, Rotate: rotate, LeafSize: 4, Seed: 24})
+			for i := 0; i < 20; i++ {
+				target := NewPointOf(-1, []float32{r.Float32(), r.Float32(), r.Float32(), r.Float32()})
+				want := KNN(Build(ps, 0, nil), target, 5, nil)
+				got, _ := f.KNN(target, 5, 0, metric)
+				for j := range want {
+					if got[j].Data() != want[j].Data() {
+						t.Error(`rotate `, rotate, ` want: `, want[j], `
+		got: `, got[j])
+					}
+				}
+			}
+			if nearest, _ := f.NN(ps[7], 10, metric); nearest != ps[7] {
+				t.Error(`rotate `, rotate, ` want: `, ps[7], `
+		got: `, nearest)
+			}
+		}
+	}
+}
+
+func Test_Forest_Seeded_And_Edge_Cases(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 300; i++ {
+		ds = append(ds, RandomDatapointInRange(6, 0, 1))
+	}
+	target := RandomDatapointInRange(6, 0, 1)
+	a, examinedA := NewForest(ds, ForestOptions{Rotate: true, Seed: 7}).KNN(target, 3, 10, nil)
+	b, examinedB := NewForest(ds, ForestOptions{Rotate: true, Seed: 7}).KNN(target, 3, 10, nil)
+	if !a.EqualTo(b) || examinedA != examinedB {
+		t.Error(`want: the same results from the same seed
+		got: `, a.PointsSetString(), ` and `, b.PointsSetString())
+	}
+
+	empty := NewForest(nil, ForestOptions{Rotate: true})
+	if got, _ := empty.NN(target, 10, nil); got != nil {
+		t.Error(`want: nil from an empty Forest
+		got: `, got)
+	}
+	if got, _ := NewForest(ds, ForestOptions{}).KNN(target, 0, 10, nil); got != nil {
+		t.Error(`want: nothing for k of 0
+		got: `, got.PointsSetString())
+	}
+}
@@ -5,25 +5,18 @@ import "math"
 // Convert uses the Importable interface to cleanly produce a kdtree
 // from a slice of some type which has implented ToDataPoint(), and
 // according to the pivot algorithm (PivotFunc).
+// It returns the same errors as BuildChecked, with indices into c.
 func Convert(c []Importable, sorting bool, pivotDef PivotFunc) (*Branch, error) {
 	var points = make(Datapoints, len(c), len(c))
-	// basedim := len(c[0].ToDatapoint().set)
 	for i := range c {
 		points[i] = c[i].ToDatapoint()
-		// TODO:
-		// Implement build error types.
-		// e.g.
-		// if points[i].Dimensionality() != basedim {
-		// 	return nil, DimClashError
-		// }
 	}
 
 	if pivotDef == nil {
 		pivotDef = LazyAverage
 	}
 
-	b := Build(points, 0, pivotDef)
-	return b, nil
+	return BuildChecked(points, 0, pivotDef)
 }
 
 // Distance returns the Euclidean length of the line connecting any two Datapoints
@@ -1,6 +1,7 @@
 package kdtree
 
 import (
+	"errors"
 	"math"
 	"testing"
 )
@@ -53,3 +54,60 @@ func Test_Func_Squared_Distance_Btwn_Datapoints(t *testing.T) {
 		}
 	}
 }
+
+type rawPoint []float64
+
+func (r rawPoint) ToDatapoint() *Datapoint {
+	return NewDatapoint(nil, r)
+}
+
+type nilPoint struct{}
+
+func (nilPoint) ToDatapoint() *Datapoint {
+	return nil
+}
+
+func Test_Func_Convert_Errors(t *testing.T) {
+	A := char('a')
+	S := myString("Hello!")
+
+	if _, err := Convert([]Importable{}, false, nil); err != ErrEmpty {
+		t.Error(`want: `, ErrEmpty, `
+		got: `, err)
+	}
+
+	_, err := Convert([]Importable{&A, rawPoint{1, 2}, &S}, false, Median)
+	var dimErr *DimClashError
+	if !errors.As(err, &dimErr) || !errors.Is(err, ErrDimClash) {
+		t.Fatal(`want: *DimClashError
+		got: `, err)
+	}
+	if dimErr.Index != 2 || dimErr.Want != 2 || dimErr.Got != 6 {
+		t.Error(`want: index 2, dimensionality 6 not 2
+		got: `, dimErr)
+	}
+
+	_, err = Convert([]Importable{rawPoint{1, 2}, rawPoint{3, math.Inf(-1)}}, false, nil)
+	var finiteErr *NonFiniteError
+	if !errors.As(err, &finiteErr) || !errors.Is(err, ErrNonFinite) {
+		t.Fatal(`want: *NonFiniteError
+		got: `, err)
+	}
+	if finiteErr.Index != 1 || finiteErr.Axis != 1 || !math.IsInf(finiteErr.Value, -1) {
+		t.Error(`want: -Inf at index 1, axis 1
+		got: `, finiteErr)
+	}
+
+	_, err = Convert([]Importable{rawPoint{1, 2}, nilPoint{}}, false, nil)
+	var nilErr *NilDatapointError
+	if !errors.As(err, &nilErr) || !errors.Is(err, ErrNilDatapoint) || nilErr.Index != 1 {
+		t.Error(`want: nil Datapoint at index 1
+		got: `, err)
+	}
+
+	tree, err := Convert([]Importable{&A, rawPoint{1, 2}, rawPoint{3, 4}}, false, Median)
+	if err != nil || tree == nil || tree.size() != 3 {
+		t.Error(`want: tree of 3 Datapoints
+		got: `, tree, err)
+	}
+}
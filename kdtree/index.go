@@ -0,0 +1,72 @@
+package kdtree
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// IndexOf makes a k-d tree safe to share between goroutines: any number of readers
+// query immutable snapshots of it without locking, while writers take turns to
+// build the next version and publish it atomically.
+// A write copies only the branches on the path it changes, sharing the rest of
+// the tree with earlier snapshots, which remain valid for as long as they are held.
+type IndexOf[C Coordinate, T any] struct {
+	mu   sync.Mutex // serialises writers
+	root atomic.Pointer[TreeOf[C, T]]
+}
+
+// Index makes a Branch safe to share between goroutines.
+type Index = IndexOf[float64, interface{}]
+
+// NewIndex returns an IndexOf over the tree rooted at root, which it takes
+// ownership of: root must not be modified other than through the Index.
+func NewIndex[C Coordinate, T any](root *TreeOf[C, T]) *IndexOf[C, T] {
+	ix := &IndexOf[C, T]{}
+	ix.root.Store(root)
+	return ix
+}
+
+// Snapshot returns the current version of the tree. It is never modified, so it
+// can be passed to any of the queries, and held for as long as needed, but must
+// not itself have Insert, Delete or Compact called on it.
+func (ix *IndexOf[C, T]) Snapshot() *TreeOf[C, T] {
+	return ix.root.Load()
+}
+
+// Insert publishes a new version of the tree with d added, as by Branch.Insert.
+func (ix *IndexOf[C, T]) Insert(d *PointOf[C, T]) {
+	if d == nil {
+		return
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if root := ix.root.Load(); root != nil {
+		ix.root.Store(root.insert(d, true))
+	}
+}
+
+// Delete publishes a new version of the tree with a Datapoint matching d removed,
+// as by Branch.Delete, reporting whether one was found.
+func (ix *IndexOf[C, T]) Delete(d *PointOf[C, T]) bool {
+	if d == nil {
+		return false
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	root := ix.root.Load()
+	if root == nil {
+		return false
+	}
+	root, ok := root.delete(d, true)
+	if ok {
+		ix.root.Store(root)
+	}
+	return ok
+}
+
+// Compact publishes a new version of the tree compacted as by Branch.Compact.
+func (ix *IndexOf[C, T]) Compact() {
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	ix.root.Store(ix.root.Load().compact(true))
+}
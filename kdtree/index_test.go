@@ -0,0 +1,110 @@
+package kdtree
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func Test_Index_Snapshots_Are_Immutable(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 300; i++ {
+		ds = append(ds, RandomDatapointInRange(2, 0, 100))
+	}
+	ix := NewIndex(Build(append(Datapoints{}, ds...), 0, Median))
+
+	before := ix.Snapshot()
+	want, _ := json.Marshal(before)
+	target := &Datapoint{nil, []float64{50, 50}}
+	wantKNN := KNN(before, target, 10, nil)
+
+	for i := 0; i < 200; i++ {
+		ix.Insert(RandomDatapointInRange(2, 0, 100))
+		ix.Delete(ds[i])
+	}
+	ix.Compact()
+
+	got, _ := json.Marshal(before)
+	if string(got) != string(want) {
+		t.Error(`snapshot was modified by later writes`)
+	}
+	if gotKNN := KNN(before, target, 10, nil); !gotKNN.EqualTo(wantKNN) {
+		t.Error(`want: `, wantKNN.PointsSetString(), `
+		got: `, gotKNN.PointsSetString())
+	}
+
+	after := ix.Snapshot()
+	if after.size() != len(ds) {
+		t.Error(`want: `, len(ds), `
+		got: `, after.size())
+	}
+	for _, d := range ds[:200] {
+		if nearest, _ := NN(after, d, nil); nearest == d {
+			t.Error(`deleted Datapoint still in the latest snapshot `, d)
+		}
+	}
+}
+
+// run with -race to check that readers never see a write in progress.
+func Test_Index_Concurrent_Readers_And_Writer(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(2, 0, 100))
+	}
+	ix := NewIndex(Build(append(Datapoints{}, ds...), 0, Median))
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bounds := []Range{Closed(20, 60), Closed(20, 60)}
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snapshot := ix.Snapshot()
+				target := RandomDatapointInRange(2, 0, 100)
+				KNN(snapshot, target, 5, nil)
+				NN(snapshot, target, nil)
+				ANN(snapshot, target, nil)
+				RadiusQuery(snapshot, target, 10, nil)
+				for _, d := range RangeQuery(snapshot, bounds) {
+					if d == nil {
+						t.Error(`RangeQuery returned nil`)
+					}
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 500; i++ {
+		ix.Insert(RandomDatapointInRange(2, 0, 100))
+		if i%2 == 0 {
+			ix.Delete(ds[i])
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if got := ix.Snapshot().size(); got != 750 {
+		t.Error(`want: 750
+		got: `, got)
+	}
+}
+
+func Test_Tree_RangeQuery_Does_Not_Mutate(t *testing.T) {
+	ds := make(Datapoints, len(dps3))
+	copy(ds, dps3)
+	tree := Build(ds, 0, Median)
+	want, _ := json.Marshal(tree)
+	RangeQuery(tree, []Range{Closed(0, 10), Closed(0, 10)})
+	RangeQuery(tree, []Range{Closed(2, 6), Closed(3, 8)})
+	got, _ := json.Marshal(tree)
+	if string(got) != string(want) {
+		t.Error(`RangeQuery reordered the tree's Datapoints`)
+	}
+}
@@ -0,0 +1,103 @@
+package kdtree
+
+import "math"
+
+// alpha is the weight-balance factor for scapegoat rebuilds: a node is out of
+// balance once one child holds more than alpha of the node's Datapoints.
+const alpha = 0.7
+
+// Insert adds the Datapoint d to a built k-d tree without a full rebuild.
+// d descends on the existing pivots to a leaf, where it is added, and the counts
+// and bounding boxes of the branches along the way are updated. A leaf which then
+// holds more distinct Datapoints than its leaf size is split as Build would.
+// If the new leaf ends up deeper than log(n)/log(1/alpha) below branch, the
+// nearest ancestor on the path whose children are out of balance (the scapegoat)
+// is rebuilt on Median pivots, which keeps the depth of the tree logarithmic.
+// d must have the same dimensionality as the Datapoints already in the tree.
+func (branch *TreeOf[C, T]) Insert(d *PointOf[C, T]) {
+	if branch == nil || d == nil {
+		return
+	}
+	branch.insert(d, false)
+}
+
+// insert adds d below branch and returns the branch to use in its place. With
+// cow set, no existing branch is modified: each one on the path is copied first,
+// so that it can be shared with readers of the tree as it was.
+func (branch *TreeOf[C, T]) insert(d *PointOf[C, T], cow bool) *TreeOf[C, T] {
+	root := branch.own(cow)
+	path := []*TreeOf[C, T]{}
+	b := root
+	for {
+		path = append(path, b)
+		if b.isLeaf() {
+			break
+		}
+		b = b.ownChild(d, cow)
+	}
+
+	if b.count+b.dead == 0 { // the empty side of a split
+		b.Datapoints, b.tombstoned = PointsOf[C, T]{d}, nil
+	} else {
+		// a fresh slice, as the old one may be shared with other leaves or copies
+		ds := make(PointsOf[C, T], len(b.Datapoints), len(b.Datapoints)+1)
+		copy(ds, b.Datapoints)
+		b.Datapoints = append(ds, d)
+	}
+	if live := b.live(); b.options().splits(len(live), b.depth) && !live.notDistinct() {
+		b.rebuild()
+	}
+	retally(path)
+
+	height := b.MaxDepth() - root.depth
+	if float64(height) <= math.Log(float64(root.size()))/math.Log(1/alpha) {
+		return root
+	}
+	for i := len(path) - 2; i >= 0; i-- {
+		scapegoat := path[i]
+		limit := alpha * float64(scapegoat.size())
+		if float64(scapegoat.left.size()) > limit || float64(scapegoat.right.size()) > limit {
+			scapegoat.rebuild()
+			retally(path[:i])
+			break
+		}
+	}
+	return root
+}
+
+// own returns the branch itself or, with cow set, a shallow copy of it which can
+// be modified without affecting anyone holding the original.
+func (branch *TreeOf[C, T]) own(cow bool) *TreeOf[C, T] {
+	if !cow {
+		return branch
+	}
+	b := *branch
+	return &b
+}
+
+// ownChild returns the child on d's side of the pivot, after replacing it with
+// its own copy when cow is set.
+func (branch *TreeOf[C, T]) ownChild(d *PointOf[C, T], cow bool) *TreeOf[C, T] {
+	near, _ := branch.split(d)
+	child := near.own(cow)
+	if near == branch.left {
+		branch.left = child
+	} else {
+		branch.right = child
+	}
+	return child
+}
+
+// rebuild replaces the subtree rooted at branch with one built on Median pivots
+// from its live Datapoints, dropping any tombstones. The other options it was
+// built with are kept.
+func (branch *TreeOf[C, T]) rebuild() {
+	opts := *branch.options()
+	opts.Pivot = MedianOf[C, T]()
+	live := branch.live()
+	if len(live) == 0 {
+		*branch = *newLeaf(PointsOf[C, T]{nil}, branch.depth, &opts)
+		return
+	}
+	*branch = *build(live, branch.depth, &opts, nil)
+}
@@ -0,0 +1,80 @@
+package kdtree
+
+import (
+	"math"
+	"testing"
+)
+
+func Test_Insert_Matches_Build(t *testing.T) {
+	var initial, inserted Datapoints
+	for i := 0; i < 200; i++ {
+		initial = append(initial, RandomDatapointInRange(2, 0, 100))
+	}
+	for i := 0; i < 800; i++ {
+		inserted = append(inserted, RandomDatapointInRange(2, 0, 100))
+	}
+	all := append(append(Datapoints{}, initial...), inserted...)
+
+	tree := Build(append(Datapoints{}, initial...), 0, Median)
+	for _, d := range inserted {
+		tree.Insert(d)
+	}
+
+	if got := tree.size(); got != len(all) {
+		t.Error(`want: `, len(all), `
+		got: `, got)
+	}
+	for i := 0; i < 100; i++ {
+		target := RandomDatapointInRange(2, -10, 110)
+		got := KNN(tree, target, 5, nil)
+		want := bruteForceKNN(all, target, 5)
+		if !sameDistances(target, got, want) {
+			t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+		}
+	}
+}
+
+func Test_Insert_Sorted_Stays_Logarithmic(t *testing.T) {
+	tree := Build(Datapoints{&Datapoint{nil, []float64{0, 0}}}, 0, Median)
+	n := 4096
+	for i := 1; i < n; i++ {
+		tree.Insert(&Datapoint{nil, []float64{float64(i), float64(i)}})
+	}
+	limit := int(math.Ceil(math.Log(float64(n))/math.Log(1/alpha))) + 2
+	if got := tree.MaxDepth(); got > limit {
+		t.Error(`want: depth <= `, limit, `
+		got: `, got)
+	}
+	nearest, _ := NN(tree, &Datapoint{nil, []float64{1000.4, 1000.4}}, nil)
+	if want := (&Datapoint{nil, []float64{1000, 1000}}); !nearest.EqualTo(want) {
+		t.Error(`want: `, want, `
+		got: `, nearest)
+	}
+}
+
+func Test_Insert_Duplicates_And_Empty_Leaves(t *testing.T) {
+	ds := Datapoints{
+		&Datapoint{nil, []float64{1, 5}},
+		&Datapoint{nil, []float64{1, 5}},
+	}
+	tree := Build(ds, 0, Median)
+	// cannot be separated by a Median split on either axis
+	tree.Insert(&Datapoint{nil, []float64{2, 5}})
+	tree.Insert(&Datapoint{nil, []float64{1, 5}})
+	tree.Insert(&Datapoint{nil, []float64{-3, 5}})
+
+	if got := tree.size(); got != 5 {
+		t.Error(`want: 5
+		got: `, got)
+	}
+	got := RadiusQuery(tree, &Datapoint{nil, []float64{1, 5}}, 0, nil)
+	if len(got) != 3 {
+		t.Error(`want: 3 coincident Datapoints
+		got: `, got.PointsSetString())
+	}
+	if got := ANN(tree, &Datapoint{nil, []float64{-2, 5}}, nil); !got.EqualTo(&Datapoint{nil, []float64{-3, 5}}) {
+		t.Error(`want: (-3, 5)
+		got: `, got)
+	}
+}
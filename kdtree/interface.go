@@ -1,8 +1,11 @@
 package kdtree
 
 // Importable is the interface implemented by types who can be directly converted into a valid Datapoint.
-type Importable interface {
-	ToDatapoint() *Datapoint
+type Importable = ImportableOf[float64, interface{}]
+
+// ImportableOf is the interface implemented by types who can be directly converted into a valid PointOf.
+type ImportableOf[C Coordinate, T any] interface {
+	ToDatapoint() *PointOf[C, T]
 }
 
 // Exportable is the interface implemented by types which can be take a Datapoint and use the set of floating-point values to update the calling object's data members.
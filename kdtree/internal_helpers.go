@@ -25,10 +25,10 @@ func sum(set []float64) float64 {
 	return result
 }
 
-func sumValuesAlongAxis(ds Datapoints, axis int) float64 {
+func sumValuesAlongAxis[C Coordinate, T any](ds PointsOf[C, T], axis int) float64 {
 	var sum float64
 	for i := range ds {
-		sum += ds[i].set[axis]
+		sum += float64(ds[i].set[axis])
 	}
 	return sum
 }
@@ -39,7 +39,7 @@ const (
 )
 
 func branchToStrMatrix(branch *Branch) [][]string {
-	height, width := branch.MaxDepth(), len(branch.Datapoints)
+	height, width := branch.MaxDepth(), branch.size()
 	matrix := make([][]string, width, width)
 	for i := 0; i < height; i++ {
 		matrix[i] = append(matrix[i], make([]string, height, height)...)
@@ -0,0 +1,95 @@
+package kdtree
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// neighbour pairs a candidate Datapoint with its distance to the search target.
+type neighbour[C Coordinate, T any] struct {
+	point *PointOf[C, T]
+	dist  float64
+}
+
+// neighbourHeap is a max-heap on dist, so the root is always the current
+// k-th best candidate and can be evicted cheaply when a closer one is found.
+type neighbourHeap[C Coordinate, T any] []neighbour[C, T]
+
+func (h neighbourHeap[C, T]) Len() int            { return len(h) }
+func (h neighbourHeap[C, T]) Less(i, j int) bool  { return h[i].dist > h[j].dist }
+func (h neighbourHeap[C, T]) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *neighbourHeap[C, T]) Push(x interface{}) { *h = append(*h, x.(neighbour[C, T])) }
+func (h *neighbourHeap[C, T]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// offer adds the candidate if fewer than k have been collected, or if it is
+// closer than the current k-th best, in which case the k-th best is evicted.
+func (h *neighbourHeap[C, T]) offer(d *PointOf[C, T], dist float64, k int) {
+	if len(*h) < k {
+		heap.Push(h, neighbour[C, T]{d, dist})
+		return
+	}
+	if dist < (*h)[0].dist {
+		(*h)[0] = neighbour[C, T]{d, dist}
+		heap.Fix(h, 0)
+	}
+}
+
+// bound returns the distance a subtree must beat to be worth visiting.
+func (h neighbourHeap[C, T]) bound(k int) (float64, bool) {
+	if len(h) < k {
+		return 0, false
+	}
+	return h[0].dist, true
+}
+
+// sorted returns the collected candidates ordered nearest first.
+func (h neighbourHeap[C, T]) sorted() PointsOf[C, T] {
+	sort.Slice(h, func(i, j int) bool { return h[i].dist < h[j].dist })
+	ds := make(PointsOf[C, T], len(h), len(h))
+	for i := range h {
+		ds[i] = h[i].point
+	}
+	return ds
+}
+
+// KNN returns the k nearest-neighbouring Datapoints to target in the k-d tree branch,
+// ordered by ascending distance under metric (Euclidean if nil). Fewer than k
+// Datapoints are returned only when the branch holds fewer than k.
+// Subtrees are skipped whenever the metric's bound on the distance from target to
+// their bounding box exceeds the distance to the current k-th best candidate.
+func KNN[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], k int, metric MetricOf[C]) PointsOf[C, T] {
+	if branch == nil || k <= 0 {
+		return nil
+	}
+	if metric == nil {
+		metric = EuclideanOf[C]()
+	}
+	h := make(neighbourHeap[C, T], 0, k)
+	knn(branch, target, k, metric, &h)
+	return h.sorted()
+}
+
+func knn[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], k int, metric MetricOf[C], h *neighbourHeap[C, T]) {
+	if branch.size() == 0 {
+		return
+	}
+	if worst, full := h.bound(k); full && branch.box.lowerBound(target.set, metric) > worst {
+		return
+	}
+	if branch.isLeaf() {
+		branch.measure(target, metric, func(d *PointOf[C, T], dist float64) {
+			h.offer(d, dist, k)
+		})
+		return
+	}
+
+	near, far := branch.split(target)
+	knn(near, target, k, metric, h)
+	knn(far, target, k, metric, h)
+}
@@ -0,0 +1,108 @@
+package kdtree
+
+import (
+	"sort"
+	"testing"
+)
+
+// bruteForceKNN is the reference oracle: sort every Datapoint by distance to target.
+func bruteForceKNN(ds Datapoints, target *Datapoint, k int) Datapoints {
+	all := make(Datapoints, len(ds))
+	copy(all, ds)
+	sort.SliceStable(all, func(i, j int) bool {
+		return DistanceSq(target, all[i]) < DistanceSq(target, all[j])
+	})
+	if k > len(all) {
+		k = len(all)
+	}
+	return all[:k]
+}
+
+func sameDistances(target *Datapoint, got, want Datapoints) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if DistanceSq(target, got[i]) != DistanceSq(target, want[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_KNN_Matches_Brute_Force(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -50, 50))
+	}
+	source := make(Datapoints, len(ds))
+	copy(source, ds)
+
+	for _, pivotDef := range []PivotFunc{Median, Mean, LazyAverage} {
+		tree := Build(ds, 0, pivotDef)
+		for i := 0; i < 50; i++ {
+			target := RandomDatapointInRange(3, -60, 60)
+			for _, k := range []int{1, 5, 17} {
+				got := KNN(tree, target, k, nil)
+				want := bruteForceKNN(source, target, k)
+				if !sameDistances(target, got, want) {
+					t.Error(`k = `, k, `
+		want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+				}
+			}
+		}
+	}
+}
+
+func Test_KNN_Ordered_Nearest_First(t *testing.T) {
+	ds := make(Datapoints, len(dps3))
+	copy(ds, dps3)
+	tree := Build(ds, 0, Median)
+	target := &Datapoint{nil, []float64{5, 5}}
+	got := KNN(tree, target, len(dps3), nil)
+	if len(got) != len(dps3) {
+		t.Error(`want: `, len(dps3), `
+		got: `, len(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if DistanceSq(target, got[i-1]) > DistanceSq(target, got[i]) {
+			t.Error(`out of order: `, got.PointsSetString())
+			break
+		}
+	}
+}
+
+func Test_KNN_Edge_Cases(t *testing.T) {
+	ds := make(Datapoints, len(nonDistinctDps))
+	copy(ds, nonDistinctDps) // Median sorts in place; leave the shared fixture alone
+	tree := Build(ds, 0, Median)
+	target := &Datapoint{nil, []float64{1, 8}}
+
+	if got := KNN(tree, target, 0, nil); got != nil {
+		t.Error(`want: nil
+		got: `, got)
+	}
+	if got := KNN(nil, target, 3, nil); got != nil {
+		t.Error(`want: nil
+		got: `, got)
+	}
+
+	got := KNN(tree, target, 100, nil)
+	if len(got) != len(nonDistinctDps) {
+		t.Error(`want: `, len(nonDistinctDps), `
+		got: `, len(got))
+	}
+
+	got = KNN(tree, target, 4, nil)
+	want := Datapoints{
+		&Datapoint{nil, []float64{1, 9}},
+		&Datapoint{nil, []float64{1, 9}},
+		&Datapoint{nil, []float64{1, 9}},
+		&Datapoint{nil, []float64{1, 9}},
+	}
+	if !got.EqualTo(want) {
+		t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+	}
+}
@@ -0,0 +1,263 @@
+package kdtree
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MetricOf defines a distance between the coordinates of PointOfs for the
+// nearest-neighbour and radius queries, accumulated in float64 whatever their type.
+// AxisBound must return a lower bound on Distance for any two points whose values
+// along axis differ by diff, which is what allows a query to skip the far side of a
+// splitting plane. It must not decrease as |diff| grows.
+type MetricOf[C Coordinate] interface {
+	Distance(p, q []C) float64
+	AxisBound(axis int, diff float64) float64
+}
+
+// Metric defines a distance between the values of Datapoints.
+type Metric = MetricOf[float64]
+
+// boxBounder is implemented by the Metrics which can bound the distance to a Box
+// more tightly than by the greatest of the AxisBounds of its gaps on each axis.
+type boxBounder[C Coordinate] interface {
+	boxBound(b BoxOf[C], target []C) float64
+}
+
+type euclidean[C Coordinate] struct{}
+
+func (euclidean[C]) Distance(p, q []C) float64 {
+	var sq float64
+	for i := range p {
+		v := float64(q[i]) - float64(p[i])
+		sq += v * v
+	}
+	return math.Sqrt(sq)
+}
+func (euclidean[C]) AxisBound(axis int, diff float64) float64 { return math.Abs(diff) }
+func (euclidean[C]) boxBound(b BoxOf[C], target []C) float64  { return b.MinDistance(target) }
+
+type manhattan[C Coordinate] struct{}
+
+func (manhattan[C]) Distance(p, q []C) float64 {
+	var d float64
+	for i := range p {
+		d += math.Abs(float64(q[i]) - float64(p[i]))
+	}
+	return d
+}
+func (manhattan[C]) AxisBound(axis int, diff float64) float64 { return math.Abs(diff) }
+
+func (manhattan[C]) boxBound(b BoxOf[C], target []C) float64 {
+	var d float64
+	for axis, v := range target {
+		d += b.gap(axis, v)
+	}
+	return d
+}
+
+type chebyshev[C Coordinate] struct{}
+
+func (chebyshev[C]) Distance(p, q []C) float64 {
+	var d float64
+	for i := range p {
+		d = math.Max(d, math.Abs(float64(q[i])-float64(p[i])))
+	}
+	return d
+}
+func (chebyshev[C]) AxisBound(axis int, diff float64) float64 { return math.Abs(diff) }
+
+// Set of pre-defined Metrics which need no parameters. Those between coordinates
+// of any other type are returned by EuclideanOf, ManhattanOf and ChebyshevOf.
+var (
+	// Euclidean is the straight-line (L2) distance, as given by Distance.
+	// Queries use it whenever they are passed a nil Metric.
+	Euclidean Metric = euclidean[float64]{}
+
+	// Manhattan is the taxicab (L1) distance: the sum of the absolute differences along each axis.
+	Manhattan Metric = manhattan[float64]{}
+
+	// Chebyshev is the chessboard (L∞) distance: the greatest absolute difference along any axis.
+	Chebyshev Metric = chebyshev[float64]{}
+)
+
+// EuclideanOf returns the straight-line distance between coordinates of type C,
+// as Euclidean is between Datapoints.
+func EuclideanOf[C Coordinate]() MetricOf[C] { return euclidean[C]{} }
+
+// ManhattanOf returns the taxicab distance between coordinates of type C, as
+// Manhattan is between Datapoints.
+func ManhattanOf[C Coordinate]() MetricOf[C] { return manhattan[C]{} }
+
+// ChebyshevOf returns the chessboard distance between coordinates of type C, as
+// Chebyshev is between Datapoints.
+func ChebyshevOf[C Coordinate]() MetricOf[C] { return chebyshev[C]{} }
+
+type minkowski[C Coordinate] float64
+
+// NewMinkowski returns the Minkowski (Lp) distance of order p.
+// p must be at least 1 for the result to be a metric; p = +Inf gives Chebyshev.
+func NewMinkowski(p float64) (Metric, error) {
+	return NewMinkowskiOf[float64](p)
+}
+
+// NewMinkowskiOf returns the Minkowski distance between coordinates of type C,
+// as NewMinkowski does between Datapoints.
+func NewMinkowskiOf[C Coordinate](p float64) (MetricOf[C], error) {
+	switch {
+	case math.IsNaN(p) || p < 1:
+		return nil, fmt.Errorf("kdtree: Minkowski order must be >= 1, got %v", p)
+	case p == 1:
+		return ManhattanOf[C](), nil
+	case p == 2:
+		return EuclideanOf[C](), nil
+	case math.IsInf(p, 1):
+		return ChebyshevOf[C](), nil
+	}
+	return minkowski[C](p), nil
+}
+
+func (m minkowski[C]) Distance(p, q []C) float64 {
+	var d float64
+	for i := range p {
+		d += math.Pow(math.Abs(float64(q[i])-float64(p[i])), float64(m))
+	}
+	return math.Pow(d, 1/float64(m))
+}
+func (minkowski[C]) AxisBound(axis int, diff float64) float64 { return math.Abs(diff) }
+
+type weightedEuclidean[C Coordinate] []float64
+
+// NewWeightedEuclidean returns the Euclidean distance with each axis scaled by the
+// matching weight, i.e. sqrt(Σ wᵢ(pᵢ-qᵢ)²). Weights must be non-negative. Axes
+// beyond the last weight are weighted 1, and weights beyond the last axis are
+// ignored.
+func NewWeightedEuclidean(weights []float64) (Metric, error) {
+	return NewWeightedEuclideanOf[float64](weights)
+}
+
+// NewWeightedEuclideanOf returns the weighted Euclidean distance between
+// coordinates of type C, as NewWeightedEuclidean does between Datapoints.
+func NewWeightedEuclideanOf[C Coordinate](weights []float64) (MetricOf[C], error) {
+	w := make(weightedEuclidean[C], len(weights), len(weights))
+	for i := range weights {
+		if math.IsNaN(weights[i]) || math.IsInf(weights[i], 0) || weights[i] < 0 {
+			return nil, fmt.Errorf("kdtree: weight %d must be finite and non-negative, got %v", i, weights[i])
+		}
+		w[i] = weights[i]
+	}
+	return w, nil
+}
+
+// weight returns the weight of axis, which is 1 beyond the last given.
+func (w weightedEuclidean[C]) weight(axis int) float64 {
+	if axis < len(w) {
+		return w[axis]
+	}
+	return 1
+}
+
+func (w weightedEuclidean[C]) Distance(p, q []C) float64 {
+	var d float64
+	for i := range p {
+		v := float64(q[i]) - float64(p[i])
+		d += w.weight(i) * v * v
+	}
+	return math.Sqrt(d)
+}
+
+func (w weightedEuclidean[C]) AxisBound(axis int, diff float64) float64 {
+	return math.Sqrt(w.weight(axis)) * math.Abs(diff)
+}
+
+func (w weightedEuclidean[C]) boxBound(b BoxOf[C], target []C) float64 {
+	var d float64
+	for axis, v := range target {
+		gap := b.gap(axis, v)
+		d += w.weight(axis) * gap * gap
+	}
+	return math.Sqrt(d)
+}
+
+type mahalanobis[C Coordinate] struct {
+	cholesky [][]float64 // lower-triangular L, where LLᵀ is the covariance matrix
+	spread   []float64   // square root of each variance on the covariance diagonal
+}
+
+// NewMahalanobis returns the Mahalanobis distance sqrt((p-q)ᵀ Σ⁻¹ (p-q)) for the
+// given covariance matrix Σ, which must be square, symmetric and positive-definite.
+func NewMahalanobis(covariance [][]float64) (Metric, error) {
+	return NewMahalanobisOf[float64](covariance)
+}
+
+// NewMahalanobisOf returns the Mahalanobis distance between coordinates of type
+// C, as NewMahalanobis does between Datapoints.
+func NewMahalanobisOf[C Coordinate](covariance [][]float64) (MetricOf[C], error) {
+	n := len(covariance)
+	for i := range covariance {
+		if len(covariance[i]) != n {
+			return nil, errors.New("kdtree: covariance matrix must be square")
+		}
+		for j := 0; j < i; j++ {
+			if covariance[i][j] != covariance[j][i] {
+				return nil, errors.New("kdtree: covariance matrix must be symmetric")
+			}
+		}
+	}
+	l, err := cholesky(covariance)
+	if err != nil {
+		return nil, err
+	}
+	m := mahalanobis[C]{cholesky: l, spread: make([]float64, n, n)}
+	for i := range covariance {
+		m.spread[i] = math.Sqrt(covariance[i][i])
+	}
+	return m, nil
+}
+
+// Distance solves Ly = p-q by forward substitution, as (p-q)ᵀ Σ⁻¹ (p-q) = |y|².
+func (m mahalanobis[C]) Distance(p, q []C) float64 {
+	y := make([]float64, len(p), len(p))
+	var d float64
+	for i := range p {
+		v := float64(q[i]) - float64(p[i])
+		for j := 0; j < i; j++ {
+			v -= m.cholesky[i][j] * y[j]
+		}
+		y[i] = v / m.cholesky[i][i]
+		d += y[i] * y[i]
+	}
+	return math.Sqrt(d)
+}
+
+// AxisBound uses the fact that the smallest value of vᵀ Σ⁻¹ v over all v with a
+// fixed component vₐ = diff is diff²/Σₐₐ.
+func (m mahalanobis[C]) AxisBound(axis int, diff float64) float64 {
+	return math.Abs(diff) / m.spread[axis]
+}
+
+// cholesky returns the lower-triangular factor L of a symmetric matrix A = LLᵀ,
+// failing if A is not positive-definite.
+func cholesky(a [][]float64) ([][]float64, error) {
+	n := len(a)
+	l := make([][]float64, n, n)
+	for i := range a {
+		l[i] = make([]float64, n, n)
+		for j := 0; j <= i; j++ {
+			v := a[i][j]
+			for k := 0; k < j; k++ {
+				v -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				if v <= 0 || math.IsNaN(v) {
+					return nil, errors.New("kdtree: covariance matrix must be positive-definite")
+				}
+				l[i][i] = math.Sqrt(v)
+			} else {
+				l[i][j] = v / l[j][j]
+			}
+		}
+	}
+	return l, nil
+}
@@ -0,0 +1,119 @@
+package kdtree
+
+import (
+	"math"
+	"sort"
+	"testing"
+)
+
+func Test_Metric_Distances(t *testing.T) {
+	p := &Datapoint{nil, []float64{1, -2, 3}}
+	q := &Datapoint{nil, []float64{4, 2, 3}}
+
+	minkowski3, _ := NewMinkowski(3)
+	weighted, _ := NewWeightedEuclidean([]float64{4, 0.25, 9})
+	short, _ := NewWeightedEuclidean([]float64{4})
+	identity, _ := NewMahalanobis([][]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}})
+	diagonal, _ := NewMahalanobis([][]float64{{0.25, 0, 0}, {0, 4, 0}, {0, 0, 1}})
+
+	metricTests := []struct {
+		name   string
+		metric Metric
+		want   float64
+	}{
+		{"Euclidean", Euclidean, 5},
+		{"Manhattan", Manhattan, 7},
+		{"Chebyshev", Chebyshev, 4},
+		{"Minkowski(3)", minkowski3, math.Cbrt(27 + 64)},
+		{"WeightedEuclidean", weighted, math.Sqrt(4*9 + 0.25*16)},
+		{"WeightedEuclidean(short)", short, math.Sqrt(4*9 + 16)},
+		{"Mahalanobis(I)", identity, 5},
+		{"Mahalanobis(diag)", diagonal, math.Sqrt(9/0.25 + 16/4.0)},
+	}
+
+	for _, mt := range metricTests {
+		got := mt.metric.Distance(p.set, q.set)
+		if math.Abs(got-mt.want) > 1e-12 {
+			t.Error(mt.name, `
+		want: `, mt.want, `
+		got: `, got)
+		}
+	}
+}
+
+func Test_Metric_Constructor_Errors(t *testing.T) {
+	if _, err := NewMinkowski(0.5); err == nil {
+		t.Error(`want: error for Minkowski order < 1`)
+	}
+	if m, err := NewMinkowski(math.Inf(1)); err != nil || m != Chebyshev {
+		t.Error(`want: Chebyshev for Minkowski order +Inf`)
+	}
+	if _, err := NewWeightedEuclidean([]float64{1, -1}); err == nil {
+		t.Error(`want: error for negative weight`)
+	}
+	if _, err := NewMahalanobis([][]float64{{1, 2}, {2, 4}}); err == nil {
+		t.Error(`want: error for covariance which is not positive-definite`)
+	}
+	if _, err := NewMahalanobis([][]float64{{1, 0.5}, {0, 1}}); err == nil {
+		t.Error(`want: error for asymmetric covariance`)
+	}
+	if _, err := NewMahalanobis([][]float64{{1, 0}}); err == nil {
+		t.Error(`want: error for non-square covariance`)
+	}
+}
+
+func Test_Metric_Queries_Match_Brute_Force(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 400; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -50, 50))
+	}
+	source := make(Datapoints, len(ds))
+	copy(source, ds)
+	tree := Build(ds, 0, Median)
+
+	minkowski3, _ := NewMinkowski(3)
+	weighted, _ := NewWeightedEuclidean([]float64{10, 0.1, 1})
+	correlated, _ := NewMahalanobis([][]float64{{4, 1.5, 0}, {1.5, 1, 0.2}, {0, 0.2, 0.5}})
+	metrics := []Metric{Euclidean, Manhattan, Chebyshev, minkowski3, weighted, correlated}
+
+	for _, metric := range metrics {
+		for i := 0; i < 20; i++ {
+			target := RandomDatapointInRange(3, -60, 60)
+			sorted := make(Datapoints, len(source))
+			copy(sorted, source)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return metric.Distance(target.set, sorted[i].set) < metric.Distance(target.set, sorted[j].set)
+			})
+
+			got := KNN(tree, target, 7, metric)
+			for j := range got {
+				if metric.Distance(target.set, got[j].set) != metric.Distance(target.set, sorted[j].set) {
+					t.Errorf("%T KNN[%d]\n\t\twant: %v\n\t\tgot: %v", metric, j, sorted[j], got[j])
+					break
+				}
+			}
+
+			nearest, _ := NN(tree, target, metric)
+			if metric.Distance(target.set, nearest.set) != metric.Distance(target.set, sorted[0].set) {
+				t.Errorf("%T NN\n\t\twant: %v\n\t\tgot: %v", metric, sorted[0], nearest)
+			}
+
+			r := metric.Distance(target.set, sorted[30].set)
+			want := 0
+			for _, d := range sorted {
+				if metric.Distance(target.set, d.set) <= r {
+					want++
+				}
+			}
+			got = RadiusQuery(tree, target, r, metric)
+			if len(got) != want {
+				t.Errorf("%T RadiusQuery\n\t\twant: %v\n\t\tgot: %v", metric, want, len(got))
+			}
+			for _, d := range got {
+				if metric.Distance(target.set, d.set) > r {
+					t.Errorf("%T RadiusQuery returned %v outside r = %v", metric, d, r)
+				}
+			}
+		}
+	}
+}
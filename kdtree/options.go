@@ -0,0 +1,151 @@
+package kdtree
+
+import "math"
+
+// AxisFuncOf chooses the axis along which to split a set of PointOfs at the
+// given depth. It must return a valid axis of the PointOfs.
+type AxisFuncOf[C Coordinate, T any] func(ds PointsOf[C, T], depth int) int
+
+// AxisFunc chooses the axis along which to split a set of Datapoints at the
+// given depth. It must return a valid axis of the Datapoints.
+type AxisFunc = AxisFuncOf[float64, interface{}]
+
+// Set of pre-defined functions which match the prototype of `AxisFunc`. Those
+// for any other PointOfs are returned by CycleOf, MaxSpreadOf and MaxVarianceOf.
+var (
+	// Cycle splits along each axis in turn, on axis depth % dimensionality, as Build does.
+	Cycle = CycleOf[float64, interface{}]()
+
+	// MaxSpread splits along the axis on which the Datapoints span the widest range,
+	// which suits data whose axes are on very different scales.
+	MaxSpread = MaxSpreadOf[float64, interface{}]()
+
+	// MaxVariance splits along the axis on which the Datapoints vary the most,
+	// which unlike MaxSpread is not swayed by a few outliers.
+	MaxVariance = MaxVarianceOf[float64, interface{}]()
+)
+
+// CycleOf returns the AxisFuncOf which splits along each axis in turn, as Cycle does.
+func CycleOf[C Coordinate, T any]() AxisFuncOf[C, T] {
+	return func(ds PointsOf[C, T], depth int) int {
+		return depth % len(ds[0].set)
+	}
+}
+
+// MaxSpreadOf returns the AxisFuncOf which splits along the axis of widest range,
+// as MaxSpread does.
+func MaxSpreadOf[C Coordinate, T any]() AxisFuncOf[C, T] {
+	return maxSpread[C, T]
+}
+
+// MaxVarianceOf returns the AxisFuncOf which splits along the axis of greatest
+// variance, as MaxVariance does.
+func MaxVarianceOf[C Coordinate, T any]() AxisFuncOf[C, T] {
+	return func(ds PointsOf[C, T], depth int) int {
+		best, widest := 0, math.Inf(-1)
+		for axis := range ds[0].set {
+			if v := variance(ds, axis); v > widest {
+				best, widest = axis, v
+			}
+		}
+		return best
+	}
+}
+
+func maxSpread[C Coordinate, T any](ds PointsOf[C, T], depth int) int {
+	best, widest := 0, math.Inf(-1)
+	for axis := range ds[0].set {
+		lo, hi := math.Inf(1), math.Inf(-1)
+		for _, d := range ds {
+			v := float64(d.set[axis])
+			lo, hi = math.Min(lo, v), math.Max(hi, v)
+		}
+		if hi-lo > widest {
+			best, widest = axis, hi-lo
+		}
+	}
+	return best
+}
+
+// variance returns the population variance of the points along axis.
+func variance[C Coordinate, T any](ds PointsOf[C, T], axis int) float64 {
+	mean := sumValuesAlongAxis(ds, axis) / float64(len(ds))
+	var sq float64
+	for _, d := range ds {
+		diff := float64(d.set[axis]) - mean
+		sq += diff * diff
+	}
+	return sq / float64(len(ds))
+}
+
+// BuildOptionsOf controls how BuildWith splits PointOfs into a k-d tree.
+// The zero value builds the same tree as Build with a nil PivotFuncOf.
+type BuildOptionsOf[C Coordinate, T any] struct {
+	// Pivot calculates the pivot value of each split; LazyAverage if nil.
+	Pivot PivotFuncOf[C, T]
+
+	// Axis chooses the axis of each split; Cycle if nil.
+	Axis AxisFuncOf[C, T]
+
+	// LeafSize is the most Datapoints kept together in a leaf, other than those
+	// which no pivot can separate; 1 if less than 1.
+	LeafSize int
+
+	// MaxDepth is the greatest depth of any branch: those at MaxDepth are leaves,
+	// however many Datapoints they hold. Unlimited if 0 or less.
+	MaxDepth int
+
+	// Summaries lists the Monoids under which every branch keeps a summary of its
+	// live Datapoints, up to date through Insert and Delete, so that RangeAggregate
+	// can answer with them in constant time for any branch wholly within its bounds.
+	// They are not kept by WriteTo or MarshalJSON.
+	Summaries []*MonoidOf[C, T]
+
+	// CompactionThreshold is the share of tombstoned Datapoints above which Delete
+	// rebuilds a subtree from its live Datapoints; 0.5 if 0 or less. A value of 1
+	// or more disables compaction on Delete, leaving it to explicit calls to
+	// Compact. It is not kept by WriteTo or MarshalJSON.
+	CompactionThreshold float64
+}
+
+// BuildOptions controls how BuildWith splits Datapoints into a Branch.
+type BuildOptions = BuildOptionsOf[float64, interface{}]
+
+// withDefaults returns a copy of the options with every unset field filled in.
+func (opts BuildOptionsOf[C, T]) withDefaults() *BuildOptionsOf[C, T] {
+	if opts.Pivot == nil {
+		opts.Pivot = LazyAverageOf[C, T]()
+	}
+	if opts.Axis == nil {
+		opts.Axis = CycleOf[C, T]()
+	}
+	if opts.LeafSize < 1 {
+		opts.LeafSize = 1
+	}
+	if !(opts.CompactionThreshold > 0) {
+		opts.CompactionThreshold = 0.5
+	}
+	return &opts
+}
+
+// BuildWith constructs the k-d tree from a set of assumed to be valid Datapoints
+// OF CONSISTENT DIMENSIONALITY, as Build does, but split as set out by opts.
+// Insert and Delete keep to the same leaf size, depth limit and axis choice when
+// they rebuild any part of the tree.
+func BuildWith[C Coordinate, T any](ds PointsOf[C, T], depth int, opts BuildOptionsOf[C, T]) *TreeOf[C, T] {
+	return build(ds, depth, opts.withDefaults(), nil)
+}
+
+// options returns the options the branch was built with, or the defaults for
+// a tree which was not built with any.
+func (branch *TreeOf[C, T]) options() *BuildOptionsOf[C, T] {
+	if branch.opts == nil {
+		return BuildOptionsOf[C, T]{}.withDefaults()
+	}
+	return branch.opts
+}
+
+// splits reports whether Build should split sz Datapoints at depth.
+func (opts *BuildOptionsOf[C, T]) splits(sz, depth int) bool {
+	return sz > opts.LeafSize && (opts.MaxDepth <= 0 || depth < opts.MaxDepth)
+}
@@ -0,0 +1,207 @@
+package kdtree
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+// leaves returns every leaf under branch, left to right.
+func leaves(branch *Branch) []*Branch {
+	if branch == nil {
+		return nil
+	}
+	if branch.isLeaf() {
+		return []*Branch{branch}
+	}
+	return append(leaves(branch.left), leaves(branch.right)...)
+}
+
+func Test_BuildWith_Zero_Options_Matches_Build(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 300; i++ {
+		ds = append(ds, RandomDatapointInRange(2, 0, 50))
+	}
+	if !sameTree(BuildWith(ds, 0, BuildOptions{}), Build(ds, 0, nil)) {
+		t.Error(`want: the zero BuildOptions to build the same tree as Build`)
+	}
+}
+
+func Test_BuildWith_Leaf_Size_And_Max_Depth(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 1000; i++ {
+		ds = append(ds, RandomDatapointInRange(3, 0, 100))
+	}
+
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: Median, LeafSize: 16})
+	for _, leaf := range leaves(tree) {
+		if len(leaf.Datapoints) > 16 {
+			t.Error(`want: at most 16 Datapoints in a leaf
+		got: `, len(leaf.Datapoints))
+		}
+	}
+	if tree.MaxDepth() >= Build(ds, 0, Median).MaxDepth() {
+		t.Error(`want: a shallower tree with larger leaves`)
+	}
+
+	for i := 0; i < 100; i++ {
+		target := RandomDatapointInRange(3, 0, 100)
+		if got, want := KNN(tree, target, 5, nil), bruteForceKNN(ds, target, 5); !sameDistances(target, got, want) {
+			t.Error(`KNN want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+		}
+		nearest, _ := NN(tree, target, nil)
+		if want := bruteForceKNN(ds, target, 1); !sameDistances(target, Datapoints{nearest}, want) {
+			t.Error(`NN want: `, want.PointsSetString(), `
+		got: `, nearest.set)
+		}
+		if got, want := byIdentity(RadiusQuery(tree, target, 20, nil)), byIdentity(bruteForceRadius(ds, target, 20)); len(got) != len(want) {
+			t.Error(`RadiusQuery want: `, len(want), `
+		got: `, len(got))
+		}
+	}
+
+	bounds := []Range{Closed(10, 40), Closed(20, 70), Closed(0, 50)}
+	var want Datapoints
+	for _, d := range ds {
+		if d.set[0] >= 10 && d.set[0] <= 40 && d.set[1] >= 20 && d.set[1] <= 70 && d.set[2] <= 50 {
+			want = append(want, d)
+		}
+	}
+	if got := RangeQuery(tree, bounds); len(got) != len(want) {
+		t.Error(`RangeQuery want: `, len(want), `
+		got: `, len(got))
+	}
+
+	shallow := BuildWith(ds, 0, BuildOptions{MaxDepth: 4})
+	if shallow.MaxDepth() != 4 || shallow.size() != len(ds) {
+		t.Error(`want: depth 4 holding `, len(ds), `
+		got: depth `, shallow.MaxDepth(), ` holding `, shallow.size())
+	}
+	for i := 0; i < 50; i++ {
+		shallow.Insert(RandomDatapointInRange(3, 0, 100))
+	}
+	if shallow.MaxDepth() != 4 {
+		t.Error(`want: Insert to keep to depth 4
+		got: `, shallow.MaxDepth())
+	}
+}
+
+func Test_BuildWith_Insert_Fills_Leaf_Bucket(t *testing.T) {
+	tree := BuildWith(Datapoints{&Datapoint{nil, []float64{1, 1}}}, 0, BuildOptions{LeafSize: 4})
+	for i := 2; i <= 4; i++ {
+		tree.Insert(&Datapoint{nil, []float64{float64(i), float64(i)}})
+	}
+	if !tree.isLeaf() || tree.size() != 4 {
+		t.Error(`want: a single leaf of 4
+		got: `, countNodes(tree), ` branches`)
+	}
+	tree.Insert(&Datapoint{nil, []float64{5, 5}})
+	if tree.isLeaf() || tree.size() != 5 {
+		t.Error(`want: the leaf split once it held 5`)
+	}
+}
+
+func Test_BuildWith_Custom_Axis_Survives_Serialisation(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 200; i++ {
+		ds = append(ds, RandomDatapointInRange(3, 0, 100))
+	}
+	lastAxis := func(ds Datapoints, depth int) int { return len(ds[0].set) - 1 - depth%2 }
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: Median, Axis: lastAxis, LeafSize: 3, MaxDepth: 20})
+
+	var check func(b *Branch)
+	check = func(b *Branch) {
+		if b.isLeaf() {
+			return
+		}
+		if want := 2 - b.depth%2; b.axis != want {
+			t.Error(`want: axis `, want, ` at depth `, b.depth, `
+		got: `, b.axis)
+		}
+		check(b.left)
+		check(b.right)
+	}
+	check(tree)
+
+	var fromJSON Branch
+	jsonTree, _ := json.Marshal(tree)
+	if err := json.Unmarshal(jsonTree, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	check(&fromJSON)
+
+	var buf bytes.Buffer
+	tree.WriteTo(&buf)
+	var fromBinary Branch
+	if _, err := fromBinary.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	check(&fromBinary)
+	if opts := fromBinary.options(); opts.LeafSize != 3 || opts.MaxDepth != 20 {
+		t.Error(`want: leaf size 3 and depth limit 20
+		got: `, opts.LeafSize, ` and `, opts.MaxDepth)
+	}
+}
+
+func Test_Axis_MaxSpread_And_MaxVariance(t *testing.T) {
+	// one axis spans 1e6, the others only 1
+	var ds Datapoints
+	for i := 0; i < 2000; i++ {
+		d := RandomDatapointInRange(3, 0, 1)
+		d.set[1] *= 1e6
+		ds = append(ds, d)
+	}
+	cycled := BuildWith(ds, 0, BuildOptions{Pivot: Median})
+
+	for name, axisDef := range map[string]AxisFunc{"MaxSpread": MaxSpread, "MaxVariance": MaxVariance} {
+		tree := BuildWith(ds, 0, BuildOptions{Pivot: Median, Axis: axisDef})
+		if tree.axis != 1 {
+			t.Error(name, ` want: root split on axis 1
+		got: `, tree.axis)
+		}
+
+		var check func(b *Branch)
+		check = func(b *Branch) {
+			if b.isLeaf() {
+				return
+			}
+			if want := axisDef(b.Points(), b.depth); b.axis != want {
+				t.Error(name, ` want: axis `, want, ` at depth `, b.depth, `
+		got: `, b.axis)
+			}
+			check(b.left)
+			check(b.right)
+		}
+		check(tree)
+
+		var treeVisits, cycledVisits int
+		for i := 0; i < 200; i++ {
+			target := RandomDatapointInRange(3, 0, 1)
+			target.set[1] *= 1e6
+			nearest, visited := NN(tree, target, nil)
+			want := bruteForceKNN(ds, target, 1)
+			if !sameDistances(target, Datapoints{nearest}, want) {
+				t.Error(name, ` want: `, want.PointsSetString(), `
+		got: `, nearest.set)
+			}
+			treeVisits += visited
+			_, visited = NN(cycled, target, nil)
+			cycledVisits += visited
+		}
+		if treeVisits >= cycledVisits {
+			t.Error(name, ` want: fewer branches visited than with Cycle (`, cycledVisits, `)
+		got: `, treeVisits)
+		}
+
+		var buf bytes.Buffer
+		tree.WriteTo(&buf)
+		var loaded Branch
+		if _, err := loaded.ReadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if axisRule(loaded.options().Axis) != axisRule(axisDef) {
+			t.Error(name, ` want: axis rule recorded in the header`)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package kdtree
+
+import "runtime"
+
+// parallelThreshold is the fewest Datapoints a subtree must hold before it is
+// worth handing to another goroutine.
+var parallelThreshold = 1 << 13
+
+// BuildParallel constructs the same k-d tree as Build, but builds subtrees of
+// more than a few thousand Datapoints on up to workers goroutines at once
+// (GOMAXPROCS if workers < 1). When no goroutine is free, the subtree is built
+// on the current one instead of waiting.
+// pivotDef is called concurrently on disjoint sets of Datapoints, so it must be
+// safe to do so, as the pre-defined PivotFuncs are.
+func BuildParallel[C Coordinate, T any](ds PointsOf[C, T], depth int, pivotDef PivotFuncOf[C, T], workers int) *TreeOf[C, T] {
+	return BuildWithParallel(ds, depth, BuildOptionsOf[C, T]{Pivot: pivotDef}, workers)
+}
+
+// BuildWithParallel constructs the same k-d tree as BuildWith, on up to workers
+// goroutines at once, as BuildParallel does.
+// The Pivot, Axis and every Monoid of the Summaries in opts are called concurrently
+// on disjoint sets of Datapoints, so they must be safe to do so, as the pre-defined
+// ones are.
+func BuildWithParallel[C Coordinate, T any](ds PointsOf[C, T], depth int, opts BuildOptionsOf[C, T], workers int) *TreeOf[C, T] {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	// the calling goroutine is one of the workers
+	p := &pool{slots: make(chan struct{}, workers-1)}
+	return build(ds, depth, opts.withDefaults(), p)
+}
+
+// pool bounds the number of extra goroutines building subtrees.
+type pool struct {
+	slots chan struct{}
+}
+
+// acquire reports whether a subtree of size Datapoints should be built on a new
+// goroutine, in which case release must be called once it is built.
+func (p *pool) acquire(size int) bool {
+	if p == nil || size < parallelThreshold {
+		return false
+	}
+	select {
+	case p.slots <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *pool) release() {
+	<-p.slots
+}
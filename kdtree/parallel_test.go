@@ -0,0 +1,70 @@
+package kdtree
+
+import "testing"
+
+// sameTree reports whether two trees have the same shape, axes and pivots, and hold
+// the same Datapoints in the same order at every branch.
+func sameTree(a, b *Branch) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.pivot != b.pivot || a.axis != b.axis || a.depth != b.depth || len(a.Datapoints) != len(b.Datapoints) {
+		return false
+	}
+	if len(a.summaries) != len(b.summaries) {
+		return false
+	}
+	for i := range a.summaries {
+		if a.summaries[i] != b.summaries[i] {
+			return false
+		}
+	}
+	for i := range a.Datapoints {
+		if a.Datapoints[i] != b.Datapoints[i] {
+			return false
+		}
+	}
+	return sameTree(a.left, b.left) && sameTree(a.right, b.right)
+}
+
+func Test_BuildParallel_Matches_Build(t *testing.T) {
+	defer func(threshold int) { parallelThreshold = threshold }(parallelThreshold)
+	parallelThreshold = 16
+
+	var ds Datapoints
+	for i := 0; i < 2000; i++ {
+		ds = append(ds, RandomDatapointInRange(3, 0, 10))
+	}
+	for i := 0; i < 200; i++ { // duplicate-heavy, to exercise buckets too
+		ds = append(ds, &Datapoint{nil, []float64{5, 5, float64(i % 3)}})
+	}
+
+	for _, pivotDef := range []PivotFunc{Median, Mean, LazyAverage} {
+		serial := Build(append(Datapoints{}, ds...), 0, pivotDef)
+		for _, workers := range []int{0, 1, 4, 64} {
+			parallel := BuildParallel(append(Datapoints{}, ds...), 0, pivotDef, workers)
+			if !sameTree(parallel, serial) {
+				t.Errorf("%d workers: parallel build differs from Build", workers)
+			}
+		}
+	}
+
+	total := SumOf(func(d *Datapoint) float64 { return d.set[0] })
+	for _, opts := range []BuildOptions{
+		{Pivot: QuickMedian, LeafSize: 8},
+		{Pivot: SlidingMidpoint, Axis: MaxSpread, LeafSize: 4, MaxDepth: 6},
+		{Pivot: Median, Axis: MaxVariance, Summaries: []*Monoid{total}, CompactionThreshold: 0.25},
+	} {
+		serial := BuildWith(append(Datapoints{}, ds...), 0, opts)
+		for _, workers := range []int{0, 1, 4, 64} {
+			parallel := BuildWithParallel(append(Datapoints{}, ds...), 0, opts, workers)
+			if !sameTree(parallel, serial) {
+				t.Errorf("%d workers: parallel build with %+v differs from BuildWith", workers, opts)
+			}
+			if parallel.options().CompactionThreshold != serial.options().CompactionThreshold {
+				t.Error(`want: CompactionThreshold `, serial.options().CompactionThreshold, `
+		got: `, parallel.options().CompactionThreshold)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package kdtree
+
+// RadiusQuery returns every Datapoint in the k-d tree branch lying within distance r
+// of target (inclusive) under metric (Euclidean if nil), in no particular order.
+// A subtree is only visited when the ball around target reaches its bounding box.
+func RadiusQuery[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], r float64, metric MetricOf[C]) PointsOf[C, T] {
+	if branch == nil || r < 0 {
+		return nil
+	}
+	if metric == nil {
+		metric = EuclideanOf[C]()
+	}
+	var ball PointsOf[C, T]
+	radiusQuery(branch, target, r, metric, &ball)
+	return ball
+}
+
+func radiusQuery[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], r float64, metric MetricOf[C], ball *PointsOf[C, T]) {
+	if branch.size() == 0 || branch.box.lowerBound(target.set, metric) > r {
+		return
+	}
+	if branch.isLeaf() {
+		branch.measure(target, metric, func(d *PointOf[C, T], dist float64) {
+			if dist <= r {
+				*ball = append(*ball, d)
+			}
+		})
+		return
+	}
+
+	radiusQuery(branch.left, target, r, metric, ball)
+	radiusQuery(branch.right, target, r, metric, ball)
+}
@@ -0,0 +1,80 @@
+package kdtree
+
+import (
+	"sort"
+	"testing"
+)
+
+func bruteForceRadius(ds Datapoints, target *Datapoint, r float64) Datapoints {
+	var ball Datapoints
+	for _, d := range ds {
+		if Distance(target, d) <= r {
+			ball = append(ball, d)
+		}
+	}
+	return ball
+}
+
+// byIdentity puts a set of Datapoints into a canonical order so that results
+// gathered in different traversal orders can be compared.
+func byIdentity(ds Datapoints) Datapoints {
+	sorted := make(Datapoints, len(ds))
+	copy(sorted, ds)
+	sort.Slice(sorted, func(i, j int) bool {
+		for axis := range sorted[i].set {
+			if sorted[i].set[axis] != sorted[j].set[axis] {
+				return sorted[i].set[axis] < sorted[j].set[axis]
+			}
+		}
+		return false
+	})
+	return sorted
+}
+
+func Test_RadiusQuery_Matches_Brute_Force(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -50, 50))
+	}
+	source := make(Datapoints, len(ds))
+	copy(source, ds)
+	tree := Build(ds, 0, Median)
+
+	for i := 0; i < 50; i++ {
+		target := RandomDatapointInRange(3, -60, 60)
+		for _, r := range []float64{0, 5, 20, 200} {
+			got := byIdentity(RadiusQuery(tree, target, r, nil))
+			want := byIdentity(bruteForceRadius(source, target, r))
+			if !got.EqualTo(want) {
+				t.Error(`r = `, r, `
+		want: `, len(want), `
+		got: `, len(got))
+			}
+		}
+	}
+}
+
+func Test_RadiusQuery_Boundary_Inclusive(t *testing.T) {
+	ds := make(Datapoints, len(dps3))
+	copy(ds, dps3)
+	tree := Build(ds, 0, Median)
+	target := &Datapoint{nil, []float64{6, 4}}
+
+	got := byIdentity(RadiusQuery(tree, target, 4, nil))
+	want := byIdentity(Datapoints{
+		&Datapoint{nil, []float64{4, 1}},
+		&Datapoint{nil, []float64{5, 4}},
+		&Datapoint{nil, []float64{6, 8}}, // exactly r away
+		&Datapoint{nil, []float64{7, 2}},
+		&Datapoint{nil, []float64{9, 6}},
+	})
+	if !got.EqualTo(want) {
+		t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+	}
+
+	if got := RadiusQuery(tree, target, -1, nil); got != nil {
+		t.Error(`want: nil
+		got: `, got)
+	}
+}
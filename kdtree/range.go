@@ -0,0 +1,141 @@
+package kdtree
+
+import (
+	"iter"
+	"math"
+)
+
+// Range holds the lower and upper bounds of a query along one axis. Either side
+// may be inclusive or exclusive, and an infinite bound leaves that side open-ended.
+// The zero Range holds only 0; Box.Ranges gives those of a Box.
+type Range struct {
+	min, max         float64
+	minOpen, maxOpen bool
+}
+
+// Closed returns the Range [min, max], both bounds included.
+func Closed(min, max float64) Range {
+	return Range{min: min, max: max}
+}
+
+// NewRange returns the Range between min and max, each of which is included or
+// excluded as set out by minInclusive and maxInclusive. Either bound may be
+// infinite, whereas a NaN bound holds nothing.
+func NewRange(min, max float64, minInclusive, maxInclusive bool) Range {
+	return Range{min: min, max: max, minOpen: !minInclusive, maxOpen: !maxInclusive}
+}
+
+// Unbounded returns the Range holding every value.
+func Unbounded() Range {
+	return Range{min: math.Inf(-1), max: math.Inf(1)}
+}
+
+// Contains reports whether v lies within the Range.
+func (r Range) Contains(v float64) bool {
+	return r.above(v) && r.below(v)
+}
+
+// above reports whether v satisfies the lower bound of the Range.
+func (r Range) above(v float64) bool {
+	return v > r.min || !r.minOpen && v == r.min
+}
+
+// below reports whether v satisfies the upper bound of the Range.
+func (r Range) below(v float64) bool {
+	return v < r.max || !r.maxOpen && v == r.max
+}
+
+// RangeQuery returns every live Datapoint within bounds, which gives the Range
+// along each axis in turn; axes beyond the last Range are unbounded, and Ranges
+// beyond the dimensionality of the tree are ignored. The Datapoints are returned
+// in the order the tree holds them, and the tree itself is left untouched.
+func RangeQuery[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range) PointsOf[C, T] {
+	var rangeSet PointsOf[C, T]
+	RangeVisit(branch, bounds, func(d *PointOf[C, T]) bool {
+		rangeSet = append(rangeSet, d)
+		return true
+	})
+	return rangeSet
+}
+
+// RangeVisit calls visit with each of the Datapoints RangeQuery would return,
+// in the same order, without gathering them; it stops as soon as visit returns
+// false, and reports whether it went through them all. The order only changes
+// when the tree does, so results can be paged through by skipping those already
+// seen, over an Index Snapshot if the tree is written to meanwhile.
+func RangeVisit[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range, visit func(d *PointOf[C, T]) bool) bool {
+	if branch.size() == 0 {
+		return true
+	}
+	switch rangeOverlap(branch.box, bounds) {
+	case overlapNone:
+		return true
+	case overlapAll:
+		return branch.eachLive(visit)
+	}
+
+	if !branch.isLeaf() {
+		return RangeVisit(branch.left, bounds, visit) && RangeVisit(branch.right, bounds, visit)
+	}
+	for i, d := range branch.Datapoints { // a bucket only partly within bounds
+		if d != nil && !branch.isTombstoned(i) && inRanges(d, bounds) && !visit(d) {
+			return false
+		}
+	}
+	return true
+}
+
+// RangeSeq returns an iterator over the Datapoints RangeQuery would return, in
+// the same order, which finds each one only as it is asked for.
+func RangeSeq[C Coordinate, T any](branch *TreeOf[C, T], bounds []Range) iter.Seq[*PointOf[C, T]] {
+	return func(yield func(*PointOf[C, T]) bool) {
+		RangeVisit(branch, bounds, yield)
+	}
+}
+
+// eachLive calls visit with each live Datapoint under branch in turn, as long
+// as it returns true, and reports whether it went through them all.
+func (branch *TreeOf[C, T]) eachLive(visit func(d *PointOf[C, T]) bool) bool {
+	if !branch.isLeaf() {
+		return branch.left.eachLive(visit) && branch.right.eachLive(visit)
+	}
+	for i, d := range branch.Datapoints {
+		if d != nil && !branch.isTombstoned(i) && !visit(d) {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	overlapNone = iota
+	overlapSome
+	overlapAll
+)
+
+// rangeOverlap tells whether none, some or all of the points in the non-empty
+// Box b may lie within bounds.
+func rangeOverlap[C Coordinate](b BoxOf[C], bounds []Range) int {
+	overlap := overlapAll
+	for axis := 0; axis < len(bounds) && axis < len(b.min); axis++ {
+		r := bounds[axis]
+		lo, hi := float64(b.min[axis]), float64(b.max[axis])
+		if !r.below(lo) || !r.above(hi) {
+			return overlapNone
+		}
+		if !r.above(lo) || !r.below(hi) {
+			overlap = overlapSome
+		}
+	}
+	return overlap
+}
+
+// inRanges reports whether d lies within bounds on every axis they share.
+func inRanges[C Coordinate, T any](d *PointOf[C, T], bounds []Range) bool {
+	for axis := 0; axis < len(bounds) && axis < len(d.set); axis++ {
+		if !bounds[axis].Contains(float64(d.set[axis])) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,184 @@
+package kdtree
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func bruteForceRange(ds Datapoints, bounds []Range) Datapoints {
+	var inside Datapoints
+next:
+	for _, d := range ds {
+		for axis, r := range bounds {
+			v := d.set[axis]
+			if v < r.min || v > r.max || r.minOpen && v == r.min || r.maxOpen && v == r.max {
+				continue next
+			}
+		}
+		inside = append(inside, d)
+	}
+	return inside
+}
+
+// randomRange returns a Range over integer bounds, so that Datapoints on the
+// integer grid fall on its sides, with each side inclusive, exclusive or unbounded.
+func randomRange(r *rand.Rand) Range {
+	min, max := float64(r.Intn(12)-1), float64(r.Intn(12)-1)
+	if min > max && r.Intn(4) > 0 {
+		min, max = max, min
+	}
+	if r.Intn(5) == 0 {
+		min = math.Inf(-1)
+	}
+	if r.Intn(5) == 0 {
+		max = math.Inf(1)
+	}
+	return NewRange(min, max, r.Intn(2) == 0, r.Intn(2) == 0)
+}
+
+func Test_Range_Sides(t *testing.T) {
+	cases := []struct {
+		r    Range
+		v    float64
+		want bool
+	}{
+		{Closed(1, 2), 1, true},
+		{Closed(1, 2), 2, true},
+		{Closed(1, 2), 2.5, false},
+		{NewRange(1, 2, false, true), 1, false},
+		{NewRange(1, 2, false, true), 2, true},
+		{NewRange(1, 2, true, false), 2, false},
+		{NewRange(1, 1, true, false), 1, false},
+		{Closed(1, 1), 1, true},
+		{Closed(2, 1), 1.5, false},
+		{NewRange(math.Inf(-1), 0, false, true), -1e300, true},
+		{Unbounded(), math.MaxFloat64, true},
+		{Closed(math.NaN(), 1), 0, false},
+		{Range{}, 0, true},
+	}
+	for _, c := range cases {
+		if got := c.r.Contains(c.v); got != c.want {
+			t.Error(c.r, ` contains `, c.v, `, want: `, c.want, `
+		got: `, got)
+		}
+	}
+}
+
+func Test_RangeQuery_Matches_Brute_Force(t *testing.T) {
+	r := rand.New(rand.NewSource(18))
+	var ds Datapoints
+	for i := 0; i < 400; i++ {
+		ds = append(ds, &Datapoint{i, []float64{float64(r.Intn(10)), float64(r.Intn(10)), float64(r.Intn(10))}})
+	}
+	trees := map[string]*Branch{
+		"Median":        Build(ds, 0, Median),
+		"LazyAverage":   Build(ds, 0, LazyAverage),
+		"leaf size 8":   BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, LeafSize: 8}),
+		"max depth 3":   BuildWith(ds, 0, BuildOptions{MaxDepth: 3}),
+		"with deletion": Build(ds, 0, Median),
+	}
+	for _, d := range ds[:100] {
+		trees["with deletion"].Delete(d)
+	}
+
+	for name, tree := range trees {
+		want, _ := json.Marshal(tree)
+		for i := 0; i < 300; i++ {
+			bounds := []Range{randomRange(r), randomRange(r), randomRange(r)}
+			source := ds
+			if name == "with deletion" {
+				source = ds[100:]
+			}
+			got := byIdentity(RangeQuery(tree, bounds))
+			expected := byIdentity(bruteForceRange(source, bounds))
+			if !got.EqualTo(expected) {
+				t.Error(name, ` `, bounds, `
+		want: `, len(expected), `
+		got: `, len(got))
+			}
+		}
+		if got, _ := json.Marshal(tree); string(got) != string(want) {
+			t.Error(name, `: RangeQuery changed the tree`)
+		}
+	}
+}
+
+func Test_RangeQuery_Partial_Bounds(t *testing.T) {
+	ds := Datapoints{
+		&Datapoint{nil, []float64{1, 5}},
+		&Datapoint{nil, []float64{2, 6}},
+		&Datapoint{nil, []float64{3, 7}},
+	}
+	tree := Build(ds, 0, Median)
+
+	// axes past the last Range are unbounded, and Ranges past the last axis ignored
+	if got := RangeQuery(tree, []Range{NewRange(1, 3, false, true)}); len(got) != 2 {
+		t.Error(`want: 2
+		got: `, got.PointsSetString())
+	}
+	if got := RangeQuery(tree, []Range{Unbounded(), Closed(6, 7), Closed(100, 100)}); len(got) != 2 {
+		t.Error(`want: 2
+		got: `, got.PointsSetString())
+	}
+	if got := RangeQuery(tree, nil); len(got) != len(ds) {
+		t.Error(`want: `, len(ds), `
+		got: `, got.PointsSetString())
+	}
+}
+
+func Test_RangeVisit_Streams_In_Order_And_Stops_Early(t *testing.T) {
+	r := rand.New(rand.NewSource(20))
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, &Datapoint{i, []float64{float64(r.Intn(20)), float64(r.Intn(20))}})
+	}
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: Median, LeafSize: 6})
+	bounds := []Range{NewRange(3, 15, true, false), NewRange(2, math.Inf(1), false, true)}
+	want := RangeQuery(tree, bounds)
+
+	var visited Datapoints
+	if !RangeVisit(tree, bounds, func(d *Datapoint) bool {
+		visited = append(visited, d)
+		return true
+	}) {
+		t.Error(`want: RangeVisit to report it went through every Datapoint`)
+	}
+	if !visited.EqualTo(want) {
+		t.Error(`want: `, want.PointsSetString(), `
+		got: `, visited.PointsSetString())
+	}
+
+	// page through the iterator, stopping each time the page is full
+	const page = 17
+	var paged Datapoints
+	for skip := 0; skip < len(want); skip += page {
+		seen := 0
+		for d := range RangeSeq(tree, bounds) {
+			if seen >= skip {
+				paged = append(paged, d)
+			}
+			seen++
+			if seen == skip+page {
+				break
+			}
+		}
+	}
+	if !paged.EqualTo(want) {
+		t.Error(`want: `, len(want), ` paged Datapoints
+		got: `, len(paged))
+	}
+
+	calls := 0
+	if RangeVisit(tree, bounds, func(d *Datapoint) bool {
+		calls++
+		return calls < 3
+	}) {
+		t.Error(`want: RangeVisit to report it stopped early`)
+	}
+	if calls != 3 {
+		t.Error(`want: 3 calls
+		got: `, calls)
+	}
+}
@@ -0,0 +1,56 @@
+package kdtree
+
+import "math/bits"
+
+// selectNth reorders ds so that ds[n] holds the Datapoint which would be there
+// were ds sorted along axis, with none before it greater and none after it smaller.
+// Should the median-of-three pivots turn out badly often enough that the expected
+// linear time is lost, the remaining range is sorted instead.
+func selectNth[C Coordinate, T any](ds PointsOf[C, T], n, axis int) {
+	lo, hi := 0, len(ds)-1
+	for budget := 2 * bits.Len(uint(len(ds))); lo < hi; budget-- {
+		if budget == 0 {
+			sortAlong(ds[lo:hi+1], axis)
+			return
+		}
+		pivot := medianOfThree(ds[lo].set[axis], ds[lo+(hi-lo)/2].set[axis], ds[hi].set[axis])
+
+		// three-way partition, so that runs of duplicates end the search at once
+		lt, i, gt := lo, lo, hi
+		for i <= gt {
+			switch v := ds[i].set[axis]; {
+			case v < pivot:
+				ds[lt], ds[i] = ds[i], ds[lt]
+				lt++
+				i++
+			case v > pivot:
+				ds[i], ds[gt] = ds[gt], ds[i]
+				gt--
+			default:
+				i++
+			}
+		}
+
+		switch {
+		case n < lt:
+			hi = lt - 1
+		case n > gt:
+			lo = gt + 1
+		default:
+			return
+		}
+	}
+}
+
+func medianOfThree[C Coordinate](a, b, c C) C {
+	if a > b {
+		a, b = b, a
+	}
+	if b > c {
+		b = c
+	}
+	if a > b {
+		return a
+	}
+	return b
+}
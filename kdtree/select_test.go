@@ -0,0 +1,121 @@
+package kdtree
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// pivots returns the pivot of every branch in pre-order.
+func pivots(branch *Branch) []float64 {
+	if branch == nil || branch.isLeaf() {
+		return nil
+	}
+	return append(append([]float64{branch.pivot}, pivots(branch.left)...), pivots(branch.right)...)
+}
+
+// skewed returns Datapoints of a heavy-tailed distribution on one axis, a tight
+// cluster with a few outliers on another, and many repeated values on the last.
+func skewed(n int) Datapoints {
+	var ds Datapoints
+	for i := 0; i < n; i++ {
+		cluster := rand.Float64() * 1e-3
+		if rand.Intn(100) == 0 {
+			cluster = 1e3 + rand.Float64()*1e3
+		}
+		ds = append(ds, &Datapoint{nil, []float64{
+			math.Exp(rand.Float64() * 20),
+			cluster,
+			float64(rand.Intn(3)),
+		}})
+	}
+	return ds
+}
+
+func Test_Select_Nth(t *testing.T) {
+	for _, n := range []int{1, 2, 3, 10, 101, 1000} {
+		ds := skewed(n)
+		for axis := 0; axis < 3; axis++ {
+			sorted := append(Datapoints{}, ds...)
+			By(Comparator(axis)).Sort(sorted)
+			k := rand.Intn(n)
+			selectNth(ds, k, axis)
+			if ds[k].set[axis] != sorted[k].set[axis] {
+				t.Fatal(`want: `, sorted[k].set[axis], `
+		got: `, ds[k].set[axis])
+			}
+			for i := range ds {
+				if (i < k && ds[i].set[axis] > ds[k].set[axis]) || (i > k && ds[i].set[axis] < ds[k].set[axis]) {
+					t.Fatal(`want: ds partitioned around `, k)
+				}
+			}
+		}
+	}
+}
+
+func Test_QuickMedian_Matches_Median(t *testing.T) {
+	ds := skewed(3000)
+	for _, axisDef := range []AxisFunc{Cycle, MaxVariance} {
+		want := pivots(BuildWith(ds, 0, BuildOptions{Pivot: Median, Axis: axisDef}))
+		got := pivots(BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, Axis: axisDef}))
+		if len(got) != len(want) {
+			t.Fatal(`want: `, len(want), ` pivots
+		got: `, len(got))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatal(`want: the pivots of Median`)
+			}
+		}
+	}
+}
+
+func Test_Pivot_Rules_Terminate_And_Balance_On_Skewed_Data(t *testing.T) {
+	const n = 1 << 13
+	ds := skewed(n)
+	// the lowest depth a tree of n single-Datapoint leaves could have
+	log2n := int(math.Ceil(math.Log2(n)))
+
+	for name, c := range map[string]struct {
+		opts     BuildOptions
+		maxDepth int
+	}{
+		"QuickMedian":     {BuildOptions{Pivot: QuickMedian, Axis: MaxVariance}, log2n + 3},
+		"SampledMedian":   {BuildOptions{Pivot: SampledMedian, Axis: MaxVariance}, 2 * log2n},
+		"SlidingMidpoint": {BuildOptions{Pivot: SlidingMidpoint, Axis: MaxSpread}, 0},
+	} {
+		tree := BuildWith(ds, 0, c.opts)
+		if tree.size() != n {
+			t.Error(name, ` want: `, n, `
+		got: `, tree.size())
+		}
+		if c.maxDepth > 0 && tree.MaxDepth() > c.maxDepth {
+			t.Error(name, ` want: depth at most `, c.maxDepth, `
+		got: `, tree.MaxDepth())
+		}
+		for i := 0; i < 50; i++ {
+			target := ds[rand.Intn(n)]
+			if nearest, _ := NN(tree, target, nil); Distance(nearest, target) != 0 {
+				t.Error(name, ` want: `, target.set, `
+		got: `, nearest.set)
+			}
+		}
+	}
+
+	// the sliding midpoint never leaves a side of a split empty
+	var walk func(b *Branch)
+	walk = func(b *Branch) {
+		if b.isLeaf() {
+			if live := b.live(); len(live) > 1 && !live.notDistinct() {
+				t.Error(`want: only coincident Datapoints in a leaf`)
+			}
+			return
+		}
+		if b.left.size() == 0 || b.right.size() == 0 {
+			t.Error(`want: both sides of the split at depth `, b.depth, ` occupied`)
+		}
+		walk(b.left)
+		walk(b.right)
+	}
+	walk(BuildWith(ds, 0, BuildOptions{Pivot: SlidingMidpoint, Axis: MaxSpread}))
+}
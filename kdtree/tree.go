@@ -1,98 +1,327 @@
 package kdtree
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
-	"math/rand"
+	"math"
 	"time"
 )
 
-// Branch is a Binary Tree Node
-type Branch struct {
-	Datapoints
+// TreeOf is a Binary Tree Node of PointOfs, which keeps their coordinates as C,
+// so that float32 embeddings or int32 grid cells take no more memory in the tree
+// than they do outside it, and hands back their data as T. Only leaves hold
+// Datapoints: an internal branch holds just the pivot and axis its subtree is
+// split on, and the bounding box of the Datapoints below it. Points returns every
+// Datapoint under a branch.
+type TreeOf[C Coordinate, T any] struct {
+	Datapoints  PointsOf[C, T]
 	pivot       float64
+	axis        int
 	depth       int
-	left, right *Branch
+	left, right *TreeOf[C, T]
+	opts        *BuildOptionsOf[C, T] // the options the branch was built with
+	count       int                   // number of live Datapoints in the subtree
+	dead        int                   // number of tombstoned Datapoints in the subtree
+	tombstoned  []bool                // at a leaf, marks which Datapoints have been deleted
+	box         BoxOf[C]              // smallest Box holding every Datapoint in the subtree, deleted or not
+	summaries   []interface{}         // summary of the live Datapoints in the subtree under each of opts.Summaries
 }
 
+// Tree is the TreeOf Points whose data is of type T, handing back the very Points
+// it was given from every query, so that their data needs no type assertions.
+type Tree[T any] = TreeOf[float64, T]
+
+// Branch is the Tree of Datapoints.
+type Branch = Tree[interface{}]
+
+// PivotFuncOf calculates the pivot value of a set of PointOfs along an axis.
+type PivotFuncOf[C Coordinate, T any] func(PointsOf[C, T], int) float64
+
 // PivotFunc calculates the pivot value
-type PivotFunc func(Datapoints, int) float64
+type PivotFunc = PivotFuncOf[float64, interface{}]
 
-// Set of pre-defined functions which match the prototype of `PivotFunc`
+// Set of pre-defined functions which match the prototype of `PivotFunc`. Those
+// for any other PointOfs are returned by LazyAverageOf, MedianOf, MeanOf,
+// QuickMedianOf, SampledMedianOf and SlidingMidpointOf.
 var (
 	// LazyAverage implements a simple fast average split to produce the pivot value
 	// Sufficient for large numbers of Datapoints with uniformly distributed values
-	LazyAverage = func(ds Datapoints, axis int) float64 {
-		sz := len(ds)
-		first := ds[0].set[axis]
-		last := ds[sz-1].set[axis]
-		pivot := (first + last) / 2
-		return pivot
-	}
+	LazyAverage = LazyAverageOf[float64, interface{}]()
 
 	// Median implements a true median split on a sorted set for the pivot value
 	// note: will be significantly slower
-	Median = func(ds Datapoints, axis int) float64 {
-		By(Comparator(axis)).Sort(ds)
-		midpoint := len(ds) / 2
-		return ds[midpoint].set[axis]
-	}
+	Median = MedianOf[float64, interface{}]()
 
 	// Mean implements a true mean (average) calculation to determine the pivot value
-	Mean = func(ds Datapoints, axis int) float64 {
-		sz := float64(len(ds))
-		return sumValuesAlongAxis(ds, axis) / sz
-	}
+	Mean = MeanOf[float64, interface{}]()
+
+	// QuickMedian finds the same pivot value as Median by quickselect, in expected
+	// linear time rather than by sorting
+	QuickMedian = QuickMedianOf[float64, interface{}]()
+
+	// SampledMedian approximates the median by that of an evenly spaced sample of
+	// at most medianSample Datapoints, for inputs too large to be worth selecting from
+	SampledMedian = SampledMedianOf[float64, interface{}]()
+
+	// SlidingMidpoint splits at the middle of the range the Datapoints span along
+	// the axis, sliding to the top of the range should rounding leave the lower side
+	// empty. So neither side is ever empty when the Datapoints differ along the axis,
+	// as they always do on the axis picked by MaxSpread
+	SlidingMidpoint = SlidingMidpointOf[float64, interface{}]()
 )
 
+// LazyAverageOf returns the PivotFuncOf which averages the first and last PointOfs,
+// as LazyAverage does.
+func LazyAverageOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return func(ds PointsOf[C, T], axis int) float64 {
+		first := float64(ds[0].set[axis])
+		last := float64(ds[len(ds)-1].set[axis])
+		return (first + last) / 2
+	}
+}
+
+// MedianOf returns the PivotFuncOf which sorts the PointOfs for their median, as
+// Median does.
+func MedianOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return func(ds PointsOf[C, T], axis int) float64 {
+		sortAlong(ds, axis)
+		return float64(ds[len(ds)/2].set[axis])
+	}
+}
+
+// MeanOf returns the PivotFuncOf which averages every PointOf, as Mean does.
+func MeanOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return func(ds PointsOf[C, T], axis int) float64 {
+		return sumValuesAlongAxis(ds, axis) / float64(len(ds))
+	}
+}
+
+// QuickMedianOf returns the PivotFuncOf which selects the median of the PointOfs,
+// as QuickMedian does.
+func QuickMedianOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return quickMedian[C, T]
+}
+
+// SampledMedianOf returns the PivotFuncOf which selects the median of a sample of
+// the PointOfs, as SampledMedian does.
+func SampledMedianOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return func(ds PointsOf[C, T], axis int) float64 {
+		if len(ds) <= medianSample {
+			return quickMedian(ds, axis)
+		}
+		stride := len(ds) / medianSample
+		sample := make(PointsOf[C, T], medianSample, medianSample)
+		for i := range sample {
+			sample[i] = ds[i*stride]
+		}
+		return quickMedian(sample, axis)
+	}
+}
+
+// SlidingMidpointOf returns the PivotFuncOf which splits at the middle of the
+// range of the PointOfs, as SlidingMidpoint does.
+func SlidingMidpointOf[C Coordinate, T any]() PivotFuncOf[C, T] {
+	return slidingMidpoint[C, T]
+}
+
+func quickMedian[C Coordinate, T any](ds PointsOf[C, T], axis int) float64 {
+	midpoint := len(ds) / 2
+	selectNth(ds, midpoint, axis)
+	return float64(ds[midpoint].set[axis])
+}
+
+func slidingMidpoint[C Coordinate, T any](ds PointsOf[C, T], axis int) float64 {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, d := range ds {
+		v := float64(d.set[axis])
+		lo, hi = math.Min(lo, v), math.Max(hi, v)
+	}
+	pivot := lo/2 + hi/2 // cannot overflow
+	if pivot <= lo {
+		return hi
+	}
+	return pivot
+}
+
+// medianSample is the most Datapoints SampledMedian selects its pivot from.
+const medianSample = 1024
+
 // Build constructs the k-d tree from a set of assumed to be valid Datapoints
-// OF CONSISTENT DIMENSIONALITY, using a provided PivotFunc algorithm
-func Build(ds Datapoints, depth int, pivotDef PivotFunc) *Branch {
+// OF CONSISTENT DIMENSIONALITY, using a provided PivotFunc algorithm.
+// ds itself is left as it is: the tree keeps its own copy of the slice.
+func Build[C Coordinate, T any](ds PointsOf[C, T], depth int, pivotDef PivotFuncOf[C, T]) *TreeOf[C, T] {
+	return build(ds, depth, BuildOptionsOf[C, T]{Pivot: pivotDef}.withDefaults(), nil)
+}
+
+// BuildChecked validates the Datapoints before building the k-d tree as Build does,
+// returning ErrEmpty, a *NilDatapointError, a *DimClashError or a *NonFiniteError
+// instead of a tree which would panic or misbehave on them.
+func BuildChecked[C Coordinate, T any](ds PointsOf[C, T], depth int, pivotDef PivotFuncOf[C, T]) (*TreeOf[C, T], error) {
+	if err := ds.Validate(); err != nil {
+		return nil, err
+	}
+	return Build(ds, depth, pivotDef), nil
+}
+
+// build copies ds into a single slice which is partitioned in place as the tree
+// is split, so that each leaf holds a sub-slice of it. With a non-nil pool, large
+// left subtrees are built on other goroutines.
+func build[C Coordinate, T any](ds PointsOf[C, T], depth int, opts *BuildOptionsOf[C, T], p *pool) *TreeOf[C, T] {
 	if ds == nil {
 		return nil
 	}
+	points := make(PointsOf[C, T], len(ds), len(ds))
+	copy(points, ds)
+	return buildSubtree(points, make(PointsOf[C, T], len(ds), len(ds)), depth, opts, p)
+}
 
+// buildSubtree splits ds, using scratch (of the same length) to keep the order
+// of the Datapoints on each side of the pivot.
+// Every split leaves Datapoints on both sides of it, so the depth of the tree is
+// bounded by the number of Datapoints, and the recursion ends at leaves of at
+// most opts.LeafSize Datapoints, or of any number of coincident ones.
+func buildSubtree[C Coordinate, T any](ds, scratch PointsOf[C, T], depth int, opts *BuildOptionsOf[C, T], p *pool) *TreeOf[C, T] {
 	sz := len(ds)
-	if sz <= 1 {
-		return &Branch{ds[:1], 0, depth, nil, nil}
+	if sz == 0 { // the empty side of a split
+		return newLeaf(PointsOf[C, T]{nil}, depth, opts)
 	}
-	if ds.notDistinct() {
-		return &Branch{ds, 0, depth, nil, nil}
+	if !opts.splits(sz, depth) || ds.notDistinct() {
+		return newLeaf(ds[:sz:sz], depth, opts)
 	}
 
-	if pivotDef == nil {
-		pivotDef = LazyAverage
+	branch := TreeOf[C, T]{
+		pivot: 0,
+		axis:  opts.Axis(ds, depth),
+		depth: depth,
+		left:  nil,
+		right: nil,
+		opts:  opts,
+	}
+	branch.pivot = opts.Pivot(ds, branch.axis)
+	l := partition(ds, scratch, branch.axis, branch.pivot)
+
+	// A degenerate split, with every Datapoint on one side, would only repeat
+	// below. Failing the pivot, split at the middle of the Datapoints along the
+	// same axis; failing the axis too, along the one they differ on the most,
+	// which they must differ on as they are not all coincident.
+	if l == 0 || l == sz {
+		branch.pivot = slidingMidpoint(ds, branch.axis)
+		l = partition(ds, scratch, branch.axis, branch.pivot)
+	}
+	if l == 0 || l == sz {
+		branch.axis = maxSpread(ds, depth)
+		branch.pivot = slidingMidpoint(ds, branch.axis)
+		l = partition(ds, scratch, branch.axis, branch.pivot)
 	}
 
-	branch := Branch{
-		Datapoints: ds,
-		pivot:      0,
-		depth:      depth,
-		left:       nil,
-		right:      nil,
+	leftSet, rightSet := ds[:l], ds[l:]
+	if p.acquire(len(leftSet)) {
+		done := make(chan struct{})
+		go func() {
+			defer p.release()
+			branch.left = buildSubtree(leftSet, scratch[:l], depth+1, opts, p)
+			close(done)
+		}()
+		branch.right = buildSubtree(rightSet, scratch[l:], depth+1, opts, p)
+		<-done
+	} else {
+		branch.left = buildSubtree(leftSet, scratch[:l], depth+1, opts, p)
+		branch.right = buildSubtree(rightSet, scratch[l:], depth+1, opts, p)
 	}
+	branch.tally()
+	return &branch
+}
 
-	dimensionality := len(branch.Datapoints[0].set)
-	axis := depth % dimensionality
-	branch.pivot = pivotDef(branch.Datapoints, axis)
+// partition stably moves the Datapoints below pivot along axis to the front of
+// ds, returning how many there are.
+func partition[C Coordinate, T any](ds, scratch PointsOf[C, T], axis int, pivot float64) int {
+	l, r := 0, 0
+	for _, d := range ds {
+		if float64(d.set[axis]) < pivot {
+			ds[l] = d
+			l++
+		} else {
+			scratch[r] = d
+			r++
+		}
+	}
+	copy(ds[l:], scratch[:r])
+	return l
+}
 
-	leftSet, rightSet := make(Datapoints, 0, sz), make(Datapoints, 0, sz)
+// newLeaf returns a leaf holding ds.
+func newLeaf[C Coordinate, T any](ds PointsOf[C, T], depth int, opts *BuildOptionsOf[C, T]) *TreeOf[C, T] {
+	leaf := &TreeOf[C, T]{Datapoints: ds, depth: depth, opts: opts}
+	leaf.tally()
+	return leaf
+}
 
-	for i := range branch.Datapoints {
-		if branch.Datapoints[i].set[axis] < branch.pivot {
-			leftSet = append(leftSet, branch.Datapoints[i])
+// tally recomputes the counts, bounding box and summaries of the branch, from the
+// Datapoints of a leaf or from the children of an internal branch.
+func (branch *TreeOf[C, T]) tally() {
+	if !branch.isLeaf() {
+		branch.count = branch.left.count + branch.right.count
+		branch.dead = branch.left.dead + branch.right.dead
+		branch.box = branch.left.box.Union(branch.right.box)
+		branch.summarise()
+		return
+	}
+	branch.count, branch.dead = 0, 0
+	for i, d := range branch.Datapoints {
+		if d == nil {
+			continue
+		}
+		if branch.isTombstoned(i) {
+			branch.dead++
 		} else {
-			rightSet = append(rightSet, branch.Datapoints[i])
+			branch.count++
 		}
 	}
+	branch.box = BoxAround(branch.Datapoints)
+	branch.summarise()
+}
 
-	branch.left = Build(leftSet, depth+1, pivotDef)
-	branch.right = Build(rightSet, depth+1, pivotDef)
-	return &branch
+// retally recomputes the counts and bounding boxes along a path from the root,
+// starting at its lowest branch.
+func retally[C Coordinate, T any](path []*TreeOf[C, T]) {
+	for i := len(path) - 1; i >= 0; i-- {
+		path[i].tally()
+	}
+}
+
+// Bounds returns the smallest Box holding every Datapoint under branch, which
+// queries use to skip whole subtrees. Deleted Datapoints may still be within it
+// until the subtree is compacted.
+func (branch *TreeOf[C, T]) Bounds() BoxOf[C] {
+	return branch.box
+}
+
+// Points returns the live Datapoints held in the leaves under branch.
+func (branch *TreeOf[C, T]) Points() PointsOf[C, T] {
+	return branch.live()
+}
+
+// entries returns every Datapoint held in the leaves under branch, including
+// those which have been deleted but not yet compacted away.
+func (branch *TreeOf[C, T]) entries() PointsOf[C, T] {
+	if branch == nil {
+		return nil
+	}
+	if !branch.isLeaf() {
+		return append(branch.left.entries(), branch.right.entries()...)
+	}
+	var entries PointsOf[C, T]
+	for _, d := range branch.Datapoints {
+		if d != nil {
+			entries = append(entries, d)
+		}
+	}
+	return entries
 }
 
 // MaxDepth returns the depth of the deepest leaf node from the input branch as 'root'
-func (branch *Branch) MaxDepth() int {
+func (branch *TreeOf[C, T]) MaxDepth() int {
 	if branch == nil {
 		return 0
 	}
@@ -107,124 +336,353 @@ func (branch *Branch) MaxDepth() int {
 // dramatically with the density of the branch passed to ANN.
 // ANN achieves an extremely high degree of accuracy when the density of the points
 // in each axis > 100,000; where density is defined as the number of leaves / (max-min).
-func ANN(branch *Branch, target *Datapoint) *Datapoint {
-	sz := len(branch.Datapoints)
-	if sz == 1 {
-		return branch.Datapoints[0]
+// metric (Euclidean if nil) only picks between the Datapoints of the leaf reached,
+// as the descent follows the pivots alone.
+// Of several coincident Datapoints, ANN always returns the first the tree holds.
+// ANNWithin bounds how far from the exact nearest neighbour the result may be.
+func ANN[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], metric MetricOf[C]) *PointOf[C, T] {
+	if branch.isLeaf() {
+		live := branch.live()
+		switch {
+		case len(live) == 0:
+			return nil
+		case len(live) == 1 || branch.coincident():
+			return live[0]
+		}
+		// a bucket of Datapoints the pivot could not separate
+		nearest, _ := NN(branch, target, metric)
+		return nearest
 	}
-	if branch.Datapoints.notDistinct() {
-		return branch.Datapoints[rand.Intn(sz)] // pick a pseudorandom point in the range.
+
+	near, far := branch.split(target)
+	if near.size() == 0 { // nothing left on this side of the pivot
+		near = far
 	}
 
-	dimensionality := len(branch.Datapoints[0].set)
-	axis := branch.depth % dimensionality
-	comparator := target.set[axis]
+	return ANN(near, target, metric)
+}
 
-	if comparator < branch.pivot {
-		branch = branch.left
-	} else {
-		branch = branch.right
+// NN returns the **exact** nearest-neighbouring Datapoint in the k-d tree branch
+// under metric (Euclidean if nil), along with the number of nodes visited to find it.
+// The search descends to the leaf containing target, then backtracks up the tree,
+// only entering a subtree when the ball around target with radius equal to the
+// best distance found so far reaches its bounding box.
+// Unless you explicitly require the exact nearest neighbour to the target, ANN
+// is cheaper, as it never backtracks.
+func NN[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], metric MetricOf[C]) (*PointOf[C, T], int) {
+	return ANNWithin(branch, target, 0, metric)
+}
+
+// ANNWithin returns an approximate nearest-neighbouring Datapoint in the k-d tree
+// branch under metric (Euclidean if nil), which is guaranteed to be no more than
+// (1+epsilon) times as far from target as the exact nearest neighbour, along with
+// the number of nodes visited to find it.
+// It searches as NN does, but skips any subtree whose bounding box is at least
+// 1/(1+epsilon) times the best distance found so far from target, so the greater
+// epsilon, the fewer nodes are visited. With an epsilon of 0, or a negative or NaN
+// one, ANNWithin returns the exact nearest neighbour, as NN does.
+func ANNWithin[C Coordinate, T any](branch *TreeOf[C, T], target *PointOf[C, T], epsilon float64, metric MetricOf[C]) (*PointOf[C, T], int) {
+	if metric == nil {
+		metric = EuclideanOf[C]()
 	}
+	if !(epsilon > 0) {
+		epsilon = 0
+	}
+	s := nnSearch[C, T]{target: target, metric: metric, slack: 1 + epsilon, bestDist: math.Inf(1)}
+	s.visit(branch)
+	return s.best, s.visited
+}
 
-	return ANN(branch, target)
+type nnSearch[C Coordinate, T any] struct {
+	target   *PointOf[C, T]
+	metric   MetricOf[C]
+	slack    float64 // 1+epsilon, by which a subtree must be nearer than the best to be searched
+	best     *PointOf[C, T]
+	bestDist float64
+	visited  int
 }
 
-func areaN(branch *Branch, target *Datapoint, granularity int) Datapoints {
-	if len(branch.Datapoints) <= granularity || branch.Datapoints.notDistinct() {
-		return branch.Datapoints
+func (s *nnSearch[C, T]) visit(branch *TreeOf[C, T]) {
+	if branch.size() == 0 || branch.box.lowerBound(s.target.set, s.metric)*s.slack >= s.bestDist {
+		return
+	}
+	s.visited++
+	if branch.isLeaf() {
+		branch.measure(s.target, s.metric, func(d *PointOf[C, T], dist float64) {
+			if dist < s.bestDist {
+				s.best, s.bestDist = d, dist
+			}
+		})
+		return
 	}
 
-	dimensionality := len(branch.Datapoints[0].set)
-	axis := branch.depth % dimensionality
-	comparator := target.set[axis]
+	near, far := branch.split(s.target)
+	s.visit(near)
+	s.visit(far)
+}
 
-	if comparator < branch.pivot {
-		branch = branch.left
-	} else {
-		branch = branch.right
+// isLeaf reports whether the branch has no children.
+func (branch *TreeOf[C, T]) isLeaf() bool {
+	return branch.left == nil && branch.right == nil
+}
+
+// coincident reports whether the branch is a leaf whose Datapoints all lie at the
+// same position, as Build keeps any number of coincident Datapoints in one leaf.
+func (branch *TreeOf[C, T]) coincident() bool {
+	if !branch.isLeaf() || branch.box.Empty() {
+		return false
+	}
+	for axis := range branch.box.min {
+		if branch.box.min[axis] != branch.box.max[axis] {
+			return false
+		}
 	}
+	return true
+}
 
-	bin := Datapoints{}
-	bin = append(bin, areaN(branch, target, granularity)...)
-	return bin
+// measure calls visit with each live Datapoint of a leaf and its distance from
+// target under metric, which is only measured once for coincident Datapoints.
+func (branch *TreeOf[C, T]) measure(target *PointOf[C, T], metric MetricOf[C], visit func(d *PointOf[C, T], dist float64)) {
+	coincident, measured := branch.coincident(), false
+	var dist float64
+	for i, d := range branch.Datapoints {
+		if d == nil || branch.isTombstoned(i) {
+			continue
+		}
+		if !coincident || !measured {
+			dist, measured = metric.Distance(target.set, d.set), true
+		}
+		visit(d, dist)
+	}
 }
 
-// NN returns the **exact** nearest-neighbouring Datapoint in the k-d tree branch.
-// As the process is approximately 3X slower than ANN, unless you explicitly require
-// the exact nearest nerighbour to the target, use ANN instead in most cases.
-func NN(branch *Branch, target *Datapoint) *Datapoint {
-	bin := areaN(branch, target, 10)
-	best := bin[0]
-	for i := 1; i < len(bin); i++ {
-		if DistanceSq(target, bin[i]) < DistanceSq(target, best) {
-			best = bin[i]
+// Multiplicity returns the number of live Datapoints in the tree which coincide
+// with target. They are all held in the one leaf target descends to, and when
+// nothing else is held there, the leaf's count is the answer.
+func (branch *TreeOf[C, T]) Multiplicity(target *PointOf[C, T]) int {
+	b := branch
+	for b != nil && !b.isLeaf() {
+		b, _ = b.split(target)
+	}
+	if b == nil || b.count == 0 {
+		return 0
+	}
+	if b.coincident() {
+		if target.EqualTo(&PointOf[C, T]{set: b.box.min}) {
+			return b.count
 		}
+		return 0
 	}
-	return best
+	n := 0
+	for i, d := range b.Datapoints {
+		if d != nil && !b.isTombstoned(i) && d.EqualTo(target) {
+			n++
+		}
+	}
+	return n
 }
 
-func inRange(xmin, xmax, lo, hi float64) bool {
-	return xmin >= lo && xmax <= hi
+// size returns the number of live Datapoints held under the branch, not counting
+// tombstones or the nil placeholder Build leaves on the empty side of a split.
+func (branch *TreeOf[C, T]) size() int {
+	if branch == nil {
+		return 0
+	}
+	return branch.count
 }
 
-// Range holds lower and upper range values
-type Range struct {
-	min, max float64
+// split returns the child on the same side of the pivot as target, and the child
+// on the opposite side.
+func (branch *TreeOf[C, T]) split(target *PointOf[C, T]) (near, far *TreeOf[C, T]) {
+	if float64(target.set[branch.axis]) < branch.pivot {
+		return branch.left, branch.right
+	}
+	return branch.right, branch.left
 }
 
-// RangeQuery returns all Datapoints in a specified bounded area
-func RangeQuery(branch *Branch, bounds []Range) Datapoints {
-	if branch == nil {
-		return nil
+// MarshalJSON implements json.Marshaler interface. Every branch lists the
+// Datapoints under it, although only leaves hold them, and records its Axis
+// unless it is the one Cycle would have chosen.
+func (branch *TreeOf[C, T]) MarshalJSON() ([]byte, error) {
+	ds := branch.Datapoints
+	if !branch.isLeaf() {
+		ds = branch.entries()
 	}
+	m := map[string]interface{}{
+		"Depth":       branch.depth,
+		"Cardinality": len(ds),
+		"Datapoints":  ds,
+		"Pivot":       branch.pivot,
+		"leftChild":   branch.left,
+		"rightChild":  branch.right,
+	}
+	if !branch.isLeaf() && len(ds) > 0 && branch.axis != branch.depth%len(ds[0].set) {
+		m["Axis"] = branch.axis
+	}
+	if branch.dead > 0 {
+		m["Dead"] = branch.dead
+		if branch.isLeaf() {
+			m["Tombstoned"] = branch.tombstoned
+		}
+	}
+	return json.Marshal(m)
+}
 
-	dimensionality := len(branch.Datapoints[0].set)
-	last := len(branch.Datapoints) - 1
-	intersection := false
-
-	if len(branch.Datapoints) <= 5 {
-		for axis := 0; axis < dimensionality; axis++ {
-			By(Comparator(axis)).Sort(branch.Datapoints)
-			intersection = inRange(
-				branch.Datapoints[0].set[axis],
-				branch.Datapoints[last].set[axis],
-				bounds[axis].min,
-				bounds[axis].max,
-			)
-			if !intersection {
-				break
-			}
+type branchJSON struct {
+	Depth       int
+	Cardinality int
+	Datapoints  []json.RawMessage
+	Pivot       float64
+	Axis        *int
+	Tombstoned  []bool
+	LeftChild   *branchJSON `json:"leftChild"`
+	RightChild  *branchJSON `json:"rightChild"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler interface, rebuilding the tree written
+// by MarshalJSON. Datapoints are decoded from the leaves only: the lists of those
+// above them are not read beyond checking their Cardinality.
+func (branch *TreeOf[C, T]) UnmarshalJSON(b []byte) error {
+	var raw branchJSON
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+	decoded, err := decodeBranch(&raw, BuildOptionsOf[C, T]{}.withDefaults())
+	if err != nil {
+		return err
+	}
+	dimensionality := 0
+	if entries := decoded.entries(); len(entries) > 0 {
+		if err := entries.Validate(); err != nil {
+			return err
 		}
+		dimensionality = len(entries[0].set)
 	}
-	if intersection {
-		return branch.Datapoints
+	lo, hi := make([]float64, dimensionality, dimensionality), make([]float64, dimensionality, dimensionality)
+	for axis := range lo {
+		lo[axis], hi[axis] = math.Inf(-1), math.Inf(1)
 	}
+	if err := decoded.tallyTree(lo, hi); err != nil {
+		return err
+	}
+	*branch = *decoded
+	return nil
+}
 
-	axis := branch.depth % dimensionality
+// tallyTree tallies every branch in the tree, children first, and sets the axis
+// of each internal branch which has none recorded as Build would have chosen it.
+// lo and hi bound the values the pivots above branch leave room for along each
+// axis, as for ReadFrom: every pivot must lie within them, and every Datapoint on
+// its side of each pivot.
+func (branch *TreeOf[C, T]) tallyTree(lo, hi []float64) error {
+	dimensionality := len(lo)
+	if branch.isLeaf() {
+		for _, d := range branch.Datapoints {
+			if d == nil {
+				continue
+			}
+			for axis, c := range d.set {
+				if v := float64(c); v < lo[axis] || v >= hi[axis] {
+					return fmt.Errorf("kdtree: Datapoint value %v on axis %d at depth %d is on the wrong side of a pivot",
+						v, axis, branch.depth)
+				}
+			}
+		}
+		branch.tally()
+		return nil
+	}
 
-	var rangeSet, leftSet, rightSet Datapoints
-	if branch.pivot > bounds[axis].min { // continue tree traversal left
-		leftSet = RangeQuery(branch.left, bounds)
+	switch {
+	case branch.axis < 0 && dimensionality > 0:
+		branch.axis = branch.depth % dimensionality
+	case branch.axis < 0:
+		branch.axis = 0
+	case branch.axis >= dimensionality:
+		return fmt.Errorf("kdtree: branch at depth %d split on axis %d of %d", branch.depth, branch.axis, dimensionality)
 	}
-	if branch.pivot <= bounds[axis].max {
-		rightSet = RangeQuery(branch.right, bounds)
+	axis := branch.axis
+	if dimensionality > 0 && (math.IsNaN(branch.pivot) || branch.pivot < lo[axis] || branch.pivot > hi[axis]) {
+		return fmt.Errorf("kdtree: pivot %v at depth %d is out of range", branch.pivot, branch.depth)
+	}
+	if dimensionality == 0 { // no Datapoints to check against the pivots
+		if err := branch.left.tallyTree(lo, hi); err != nil {
+			return err
+		}
+		if err := branch.right.tallyTree(lo, hi); err != nil {
+			return err
+		}
+		branch.tally()
+		return nil
 	}
 
-	rangeSet = append(rangeSet, leftSet...)
-	rangeSet = append(rangeSet, rightSet...)
-	return rangeSet
+	bound := hi[axis]
+	hi[axis] = branch.pivot
+	err := branch.left.tallyTree(lo, hi)
+	hi[axis] = bound
+	if err != nil {
+		return err
+	}
+	bound = lo[axis]
+	lo[axis] = branch.pivot
+	err = branch.right.tallyTree(lo, hi)
+	lo[axis] = bound
+	if err != nil {
+		return err
+	}
+	branch.tally()
+	return nil
 }
 
-// MarshalJSON implements json.Marshaler interface
-func (branch *Branch) MarshalJSON() ([]byte, error) {
-	return json.Marshal(map[string]interface{}{
-		"Depth":       branch.depth,
-		"Cardinality": len(branch.Datapoints),
-		"Datapoints":  branch.Datapoints,
-		"Pivot":       branch.pivot,
-		"leftChild":   branch.left,
-		"rightChild":  branch.right,
-	})
+// decodeBranch returns the tree written to raw, every branch of which shares opts.
+func decodeBranch[C Coordinate, T any](raw *branchJSON, opts *BuildOptionsOf[C, T]) (*TreeOf[C, T], error) {
+	if raw.Cardinality != len(raw.Datapoints) {
+		return nil, fmt.Errorf("kdtree: branch at depth %d has %d Datapoints, want Cardinality %d",
+			raw.Depth, len(raw.Datapoints), raw.Cardinality)
+	}
+	if (raw.LeftChild == nil) != (raw.RightChild == nil) {
+		return nil, fmt.Errorf("kdtree: branch at depth %d has only one child", raw.Depth)
+	}
+	if len(raw.Tombstoned) > len(raw.Datapoints) {
+		return nil, fmt.Errorf("kdtree: branch at depth %d has more tombstones than Datapoints", raw.Depth)
+	}
+
+	branch := &TreeOf[C, T]{pivot: raw.Pivot, depth: raw.Depth, opts: opts}
+	if raw.LeftChild == nil {
+		branch.Datapoints = make(PointsOf[C, T], len(raw.Datapoints), len(raw.Datapoints))
+		branch.tombstoned = raw.Tombstoned
+		for i, rawDatapoint := range raw.Datapoints {
+			if bytes.Equal(bytes.TrimSpace(rawDatapoint), []byte("null")) {
+				continue
+			}
+			d := &PointOf[C, T]{}
+			if err := d.UnmarshalJSON(rawDatapoint); err != nil {
+				return nil, err
+			}
+			branch.Datapoints[i] = d
+		}
+		return branch, nil
+	}
+
+	for _, child := range []*branchJSON{raw.LeftChild, raw.RightChild} {
+		if child.Depth != raw.Depth+1 {
+			return nil, fmt.Errorf("kdtree: branch at depth %d has a child at depth %d", raw.Depth, child.Depth)
+		}
+	}
+	branch.axis = -1
+	if raw.Axis != nil {
+		if *raw.Axis < 0 {
+			return nil, fmt.Errorf("kdtree: branch at depth %d split on axis %d", raw.Depth, *raw.Axis)
+		}
+		branch.axis = *raw.Axis
+	}
+	var err error
+	if branch.left, err = decodeBranch(raw.LeftChild, opts); err != nil {
+		return nil, err
+	}
+	if branch.right, err = decodeBranch(raw.RightChild, opts); err != nil {
+		return nil, err
+	}
+	return branch, nil
 }
 
 func buildDebug(ds Datapoints, depth int, pivotDef PivotFunc) *Branch {
@@ -236,40 +694,40 @@ func buildDebug(ds Datapoints, depth int, pivotDef PivotFunc) *Branch {
 	fmt.Println(ds.PointsSetString())
 	time.Sleep(250 * time.Millisecond)
 	if sz <= 1 {
-		return &Branch{ds[:1], 0, depth, nil, nil}
+		return newLeaf(ds[:1], depth, (*BuildOptions)(nil))
 	}
 	if ds.notDistinct() {
-		return &Branch{ds, 0, depth, nil, nil}
+		return newLeaf(ds, depth, (*BuildOptions)(nil))
 	}
 
 	if pivotDef == nil {
 		pivotDef = LazyAverage
 	}
 
+	dimensionality := len(ds[0].set)
 	branch := Branch{
-		Datapoints: ds,
-		pivot:      0,
-		depth:      depth,
-		left:       nil,
-		right:      nil,
+		pivot: 0,
+		axis:  depth % dimensionality,
+		depth: depth,
+		left:  nil,
+		right: nil,
 	}
 
-	dimensionality := len(branch.Datapoints[0].set)
-	axis := depth % dimensionality
-	branch.pivot = pivotDef(branch.Datapoints, axis)
+	branch.pivot = pivotDef(ds, branch.axis)
 	fmt.Println(`branch.pivot =`, branch.pivot)
 
 	leftSet, rightSet := make(Datapoints, 0, sz), make(Datapoints, 0, sz)
 
-	for i := range branch.Datapoints {
-		if branch.Datapoints[i].set[axis] < branch.pivot {
-			leftSet = append(leftSet, branch.Datapoints[i])
+	for i := range ds {
+		if ds[i].set[branch.axis] < branch.pivot {
+			leftSet = append(leftSet, ds[i])
 		} else {
-			rightSet = append(rightSet, branch.Datapoints[i])
+			rightSet = append(rightSet, ds[i])
 		}
 	}
 
 	branch.left = buildDebug(leftSet, depth+1, pivotDef)
 	branch.right = buildDebug(rightSet, depth+1, pivotDef)
+	branch.tally()
 	return &branch
 }
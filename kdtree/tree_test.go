@@ -2,7 +2,9 @@ package kdtree
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"testing"
 )
@@ -208,3 +210,398 @@ func Test_Tree_Branch_Build_SingleDimensionDatapoints(t *testing.T) {
 		got(Median): `, string(got))
 	}
 }
+
+func countNodes(branch *Branch) int {
+	if branch == nil {
+		return 0
+	}
+	return 1 + countNodes(branch.left) + countNodes(branch.right)
+}
+
+func Test_Tree_Build_Datapoints_Only_At_Leaves(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 500; i++ {
+		ds = append(ds, RandomDatapointInRange(3, 0, 100))
+	}
+	source := append(Datapoints{}, ds...)
+	tree := Build(ds, 0, Median)
+
+	for i := range ds {
+		if ds[i] != source[i] {
+			t.Fatal(`want: Build to leave its input in order`)
+		}
+	}
+	if tree.size() != len(ds) {
+		t.Error(`want: `, len(ds), `
+		got: `, tree.size())
+	}
+	seen := map[*Datapoint]int{}
+	var walk func(b *Branch)
+	walk = func(b *Branch) {
+		if !b.isLeaf() {
+			if len(b.Datapoints) != 0 {
+				t.Error(`want: no Datapoints at depth `, b.depth, `
+		got: `, len(b.Datapoints))
+			}
+			walk(b.left)
+			walk(b.right)
+			return
+		}
+		for _, d := range b.Datapoints {
+			if d != nil {
+				seen[d]++
+			}
+		}
+	}
+	walk(tree)
+	for _, d := range ds {
+		if seen[d] != 1 {
+			t.Error(`want: each Datapoint in exactly one leaf
+		got: `, seen[d], ` for `, d.set)
+		}
+	}
+	got, want := byIdentity(tree.Points()), byIdentity(ds)
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatal(`want: Points to return every Datapoint`)
+		}
+	}
+}
+
+func Test_Tree_Build_Terminates_On_Degenerate_Splits(t *testing.T) {
+	var ds Datapoints
+	// LazyAverage splits at the first and last Datapoints, which coincide
+	ds = append(ds, &Datapoint{nil, []float64{3, 3}})
+	for i := 0; i < 100; i++ {
+		ds = append(ds, &Datapoint{nil, []float64{float64(i % 7), float64(i % 3)}})
+		ds = append(ds, &Datapoint{nil, []float64{5, 5}}) // coincident with many others
+	}
+	// the Mean of a run of 1s and one just above rounds to 1, leaving nothing below it
+	for i := 0; i < 100; i++ {
+		ds = append(ds, &Datapoint{nil, []float64{1, 1}})
+	}
+	ds = append(ds, &Datapoint{nil, []float64{math.Nextafter(1, 2), 1}})
+	ds = append(ds, &Datapoint{nil, []float64{3, 3}})
+
+	for _, pivotDef := range []PivotFunc{LazyAverage, Mean, Median, QuickMedian} {
+		for _, axisDef := range []AxisFunc{Cycle, MaxSpread} {
+			tree := BuildWith(ds, 0, BuildOptions{Pivot: pivotDef, Axis: axisDef})
+			if tree.MaxDepth() > len(ds) {
+				t.Fatal(`want: depth bounded by the number of Datapoints
+		got: `, tree.MaxDepth())
+			}
+			var walk func(b *Branch)
+			walk = func(b *Branch) {
+				if b.isLeaf() {
+					if b.size() > 1 && !b.coincident() {
+						t.Error(`want: a leaf of one or of coincident Datapoints
+		got: `, b.Datapoints.PointsSetString())
+					}
+					return
+				}
+				if b.left.size() == 0 || b.right.size() == 0 {
+					t.Error(`want: both sides of the split at depth `, b.depth, ` occupied`)
+				}
+				walk(b.left)
+				walk(b.right)
+			}
+			walk(tree)
+
+			for _, target := range ds[:20] {
+				want := 0
+				for _, d := range ds {
+					if d.EqualTo(target) {
+						want++
+					}
+				}
+				if got := tree.Multiplicity(target); got != want {
+					t.Error(`want: multiplicity `, want, ` of `, target.set, `
+		got: `, got)
+				}
+				if got := KNN(tree, target, want+1, nil); !sameDistances(target, got, bruteForceKNN(ds, target, want+1)) {
+					t.Error(`want: the coincident Datapoints and the next nearest
+		got: `, got.PointsSetString())
+				}
+			}
+		}
+	}
+
+	tree := Build(ds, 0, Median)
+	if got := tree.Multiplicity(&Datapoint{nil, []float64{-1, -1}}); got != 0 {
+		t.Error(`want: 0
+		got: `, got)
+	}
+	tree.Delete(&Datapoint{nil, []float64{5, 5}})
+	if got := tree.Multiplicity(&Datapoint{nil, []float64{5, 5}}); got != 99 {
+		t.Error(`want: 99
+		got: `, got)
+	}
+}
+
+func Test_Tree_NN_Exact(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 1000; i++ {
+		ds = append(ds, RandomDatapointInRange(2, 0, 100))
+	}
+	source := make(Datapoints, len(ds))
+	copy(source, ds)
+	tree := Build(ds, 0, Median)
+	nodes := countNodes(tree)
+
+	totalVisited := 0
+	for i := 0; i < 200; i++ {
+		target := RandomDatapointInRange(2, 0, 100)
+		want := source[0]
+		for _, d := range source[1:] {
+			if DistanceSq(target, d) < DistanceSq(target, want) {
+				want = d
+			}
+		}
+		got, visited := NN(tree, target, nil)
+		if DistanceSq(target, got) != DistanceSq(target, want) {
+			t.Error(`want: `, want, `
+		got: `, got)
+		}
+		if visited < 1 || visited > nodes {
+			t.Error(`visited: `, visited, ` of `, nodes, ` nodes`)
+		}
+		totalVisited += visited
+	}
+	if totalVisited/200 >= nodes/2 {
+		t.Error(`NN is not pruning, mean nodes visited: `, totalVisited/200, ` of `, nodes)
+	}
+}
+
+func Test_Tree_NN_Backtracks_Across_Pivot(t *testing.T) {
+	// the target falls just left of the root pivot on x, but its nearest
+	// neighbour lies just right of it, in the other subtree.
+	ds := Datapoints{
+		&Datapoint{nil, []float64{0, 0}},
+		&Datapoint{nil, []float64{1, 10}},
+		&Datapoint{nil, []float64{2, -10}},
+		&Datapoint{nil, []float64{5, 3}},
+		&Datapoint{nil, []float64{8, 8}},
+		&Datapoint{nil, []float64{9, -8}},
+	}
+	tree := Build(ds, 0, Median)
+	target := &Datapoint{nil, []float64{4.9, 3}}
+	if target.set[0] >= tree.pivot {
+		t.Fatal(`fixture no longer exercises backtracking, root pivot: `, tree.pivot)
+	}
+	want := &Datapoint{nil, []float64{5, 3}}
+	got, _ := NN(tree, target, nil)
+	if !got.EqualTo(want) {
+		t.Error(`want: `, want, `
+		got: `, got)
+	}
+}
+
+func Test_Tree_ANNWithin_Guarantee(t *testing.T) {
+	r := rand.New(rand.NewSource(21))
+	var ds Datapoints
+	for i := 0; i < 2000; i++ {
+		ds = append(ds, &Datapoint{nil, []float64{r.Float64() * 100, r.Float64() * 100, r.Float64() * 100}})
+	}
+	tree := BuildWith(ds, 0, BuildOptions{Pivot: QuickMedian, LeafSize: 4})
+
+	for _, metric := range []Metric{Euclidean, Manhattan} {
+		totals := map[float64]int{}
+		epsilons := []float64{0, 0.1, 0.5, 2}
+		for i := 0; i < 200; i++ {
+			target := &Datapoint{nil, []float64{r.Float64() * 120, r.Float64() * 120, r.Float64() * 120}}
+			exact := math.Inf(1)
+			for _, d := range ds {
+				exact = math.Min(exact, metric.Distance(target.set, d.set))
+			}
+			for _, epsilon := range epsilons {
+				got, visited := ANNWithin(tree, target, epsilon, metric)
+				if dist := metric.Distance(target.set, got.set); dist > (1+epsilon)*exact {
+					t.Error(`epsilon `, epsilon, ` want: within `, (1+epsilon)*exact, `
+		got: `, dist)
+				}
+				totals[epsilon] += visited
+			}
+		}
+		for i := 1; i < len(epsilons); i++ {
+			if totals[epsilons[i]] > totals[epsilons[i-1]] {
+				t.Error(`epsilon `, epsilons[i], ` visited `, totals[epsilons[i]], ` nodes, more than `, totals[epsilons[i-1]])
+			}
+		}
+		if totals[2] >= totals[0] {
+			t.Error(`ANNWithin is not pruning any more than NN: `, totals[2], ` of `, totals[0], ` nodes`)
+		}
+	}
+
+	for _, epsilon := range []float64{-1, math.NaN()} {
+		target := &Datapoint{nil, []float64{50, 50, 50}}
+		want, _ := NN(tree, target, nil)
+		if got, _ := ANNWithin(tree, target, epsilon, nil); got != want {
+			t.Error(`epsilon `, epsilon, ` want: `, want, `
+		got: `, got)
+		}
+	}
+}
+
+func Test_Tree_ANN_Coincident_Is_Deterministic(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 10; i++ {
+		ds = append(ds, &Datapoint{i, []float64{1, 1}})
+	}
+	tree := Build(ds, 0, Median)
+	first := ANN(tree, &Datapoint{nil, []float64{0, 0}}, nil)
+	for i := 0; i < 20; i++ {
+		if got := ANN(tree, &Datapoint{nil, []float64{0, 0}}, nil); got != first {
+			t.Error(`want: `, first.data, `
+		got: `, got.data)
+		}
+	}
+}
+
+func Test_Tree_ANN_Leaf_Uses_Metric(t *testing.T) {
+	a := &Datapoint{"a", []float64{3, 0}}
+	b := &Datapoint{"b", []float64{2, 2}}
+	tree := BuildWith(Datapoints{a, b}, 0, BuildOptions{LeafSize: 4})
+	target := &Datapoint{nil, []float64{0, 0}}
+	if got := ANN(tree, target, nil); got != b {
+		t.Error(`want: b under Euclidean
+		got: `, got)
+	}
+	if got := ANN(tree, target, Manhattan); got != a {
+		t.Error(`want: a under Manhattan
+		got: `, got)
+	}
+}
+
+func Test_Tree_BuildChecked_Errors(t *testing.T) {
+	buildTests := []struct {
+		ds   Datapoints
+		want error
+	}{
+		{nil, ErrEmpty},
+		{Datapoints{}, ErrEmpty},
+		{Datapoints{&Datapoint{nil, []float64{1, 2}}, &Datapoint{nil, []float64{1}}}, ErrDimClash},
+		{Datapoints{&Datapoint{nil, []float64{1, 2}}, &Datapoint{nil, []float64{math.NaN(), 2}}}, ErrNonFinite},
+		{Datapoints{nil, &Datapoint{nil, []float64{1, 2}}}, ErrNilDatapoint},
+		{Datapoints{&Datapoint{nil, []float64{1, 2}}, nil}, ErrNilDatapoint},
+		{Datapoints{&Datapoint{nil, []float64{1, 2}}, &Datapoint{nil, []float64{3, 4}}}, nil},
+	}
+
+	for _, bt := range buildTests {
+		tree, err := BuildChecked(bt.ds, 0, Median)
+		if !errors.Is(err, bt.want) || (bt.want == nil) != (tree != nil) {
+			t.Error(`want: `, bt.want, `
+		got: `, err)
+		}
+	}
+}
+
+func Test_Tree_Branch_json_Unmarshaller_Interface(t *testing.T) {
+	for _, fixture := range []string{"dps1_median.json", "dps2_median.json", "dps3_median.json"} {
+		want, err := ioutil.ReadFile("test_fixtures/" + fixture)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var tree Branch
+		if err := json.Unmarshal(want, &tree); err != nil {
+			t.Fatal(fixture, err)
+		}
+		got, err := json.MarshalIndent(&tree, "", "    ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Error(fixture, ` did not round trip, got: `, string(got))
+		}
+
+		// every branch must share the Datapoints decoded at the leaves
+		leaves := map[*Datapoint]bool{}
+		for _, d := range tree.live() {
+			leaves[d] = true
+		}
+		for _, d := range tree.Datapoints {
+			if d != nil && !leaves[d] {
+				t.Error(fixture, `: root holds a Datapoint which is not at any leaf `, d)
+			}
+		}
+	}
+}
+
+func Test_Tree_Branch_json_Round_Trip_Queries(t *testing.T) {
+	var ds Datapoints
+	for i := 0; i < 300; i++ {
+		ds = append(ds, RandomDatapointInRange(3, -10, 10))
+	}
+	tree := Build(ds, 0, Median)
+	for _, d := range ds[:100] {
+		tree.Delete(d)
+	}
+	tree.Insert(&Datapoint{nil, []float64{0, 0, 0}})
+
+	jsonTree, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Branch
+	if err := json.Unmarshal(jsonTree, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if loaded.size() != tree.size() || loaded.MaxDepth() != tree.MaxDepth() {
+		t.Error(`want: `, tree.size(), ` Datapoints to depth `, tree.MaxDepth(), `
+		got: `, loaded.size(), ` Datapoints to depth `, loaded.MaxDepth())
+	}
+	for i := 0; i < 50; i++ {
+		target := RandomDatapointInRange(3, -10, 10)
+		want := KNN(tree, target, 4, nil)
+		got := KNN(&loaded, target, 4, nil)
+		if !got.EqualTo(want) {
+			t.Error(`want: `, want.PointsSetString(), `
+		got: `, got.PointsSetString())
+		}
+	}
+}
+
+func Test_Tree_Branch_json_Unmarshal_Errors(t *testing.T) {
+	malformed := []string{
+		`{"Depth":0,"Cardinality":2,"Datapoints":[{"data":null,"set":[1]}],"Pivot":0,"leftChild":null,"rightChild":null}`,
+		`{"Depth":0,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":0,"leftChild":{"Depth":1,"Cardinality":0,"Datapoints":[]},"rightChild":null}`,
+		`{"Depth":0,"Cardinality":2,"Datapoints":[{"data":null,"set":[1]},{"data":null,"set":[1,2]}],"Pivot":0,"leftChild":null,"rightChild":null}`,
+		`{"Depth":0,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":0,"leftChild":{"Depth":3,"Cardinality":0,"Datapoints":[]},"rightChild":{"Depth":1,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}]}}`,
+		`{"Depth":0,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":0,"Axis":-1,"leftChild":{"Depth":1,"Cardinality":0,"Datapoints":[]},"rightChild":{"Depth":1,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}]}}`,
+		`{"Depth":0,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":2,"leftChild":{"Depth":1,"Cardinality":0,"Datapoints":[]},"rightChild":{"Depth":1,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}]}}`,
+		`{"Depth":0,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":2,"leftChild":{"Depth":1,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}],"Pivot":3,"leftChild":{"Depth":2,"Cardinality":1,"Datapoints":[{"data":null,"set":[1]}]},"rightChild":{"Depth":2,"Cardinality":0,"Datapoints":[]}},"rightChild":{"Depth":1,"Cardinality":0,"Datapoints":[]}}`,
+	}
+	for _, m := range malformed {
+		var tree Branch
+		if err := json.Unmarshal([]byte(m), &tree); err == nil {
+			t.Error(`want: error unmarshalling `, m)
+		}
+	}
+}
+
+func Test_Tree_Branch_json_Unmarshal_Swapped_Leaves(t *testing.T) {
+	ds := Datapoints{
+		&Datapoint{nil, []float64{1, 1}},
+		&Datapoint{nil, []float64{2, 5}},
+		&Datapoint{nil, []float64{7, 3}},
+		&Datapoint{nil, []float64{9, 8}},
+	}
+	jsonTree, err := json.Marshal(Build(ds, 0, Median))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw branchJSON
+	if err := json.Unmarshal(jsonTree, &raw); err != nil {
+		t.Fatal(err)
+	}
+	raw.LeftChild.LeftChild, raw.RightChild.LeftChild = raw.RightChild.LeftChild, raw.LeftChild.LeftChild
+	swapped, err := json.Marshal(&raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tree Branch
+	if err := json.Unmarshal(swapped, &tree); err == nil {
+		t.Error(`want: error unmarshalling a tree with two leaves swapped
+		got: `, string(swapped))
+	}
+}
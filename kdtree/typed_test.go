@@ -0,0 +1,143 @@
+package kdtree
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+type city struct {
+	Name       string
+	Population int
+}
+
+func Test_Tree_Typed_Queries(t *testing.T) {
+	var ps []*Point[city]
+	for i := 0; i < 300; i++ {
+		d := RandomDatapointInRange(2, 0, 100)
+		ps = append(ps, NewPoint(city{fmt.Sprint("city ", i), i * 1000}, d.set))
+	}
+	tree := BuildWith(ps, 0, BuildOptionsOf[float64, city]{Pivot: QuickMedianOf[float64, city](), LeafSize: 4})
+	if tree.size() != len(ps) {
+		t.Error(`want: `, len(ps), `
+		got: `, tree.size())
+	}
+
+	source := make(Datapoints, len(ps), len(ps))
+	for i, p := range ps {
+		source[i] = &Datapoint{p, p.set}
+	}
+	for i := 0; i < 30; i++ {
+		target := RandomDatapointInRange(2, 0, 100)
+		want := bruteForceKNN(source, target, 5)
+		got := KNN(tree, NewPoint(city{}, target.set), 5, nil)
+		for j := range want {
+			if got[j] != want[j].data.(*Point[city]) {
+				t.Error(`want: `, want[j].data.(*Point[city]).Data().Name, `
+		got: `, got[j].Data().Name)
+			}
+		}
+		if nearest, _ := NN(tree, NewPoint(city{}, target.set), nil); nearest != want[0].data.(*Point[city]) {
+			t.Error(`want: `, want[0].data.(*Point[city]).Data().Name, `
+		got: `, nearest.Data().Name)
+		}
+		if got, want := len(RadiusQuery(tree, NewPoint(city{}, target.set), 10, nil)), len(bruteForceRadius(source, target, 10)); got != want {
+			t.Error(`want: `, want, `
+		got: `, got)
+		}
+	}
+
+	bounds := []Range{Closed(20, 60), NewRange(0, 50, true, false)}
+	want := bruteForceRange(source, bounds)
+	got := RangeQuery(tree, bounds)
+	if len(got) != len(want) || RangeCount(tree, bounds) != len(want) {
+		t.Error(`want: `, len(want), `
+		got: `, len(got), `, counted `, RangeCount(tree, bounds))
+	}
+	population := 0
+	for p := range RangeSeq(tree, bounds) {
+		population += p.Data().Population
+	}
+	for _, d := range want {
+		population -= d.data.(*Point[city]).Data().Population
+	}
+	if population != 0 {
+		t.Error(`RangeSeq population off by `, population)
+	}
+	total := SumOf(func(p *Point[city]) float64 { return float64(p.Data().Population) })
+	if got := RangeAggregate(tree, bounds, total); got != float64(populationOf(want)) {
+		t.Error(`want: `, populationOf(want), `
+		got: `, got)
+	}
+}
+
+func populationOf(ds Datapoints) int {
+	population := 0
+	for _, d := range ds {
+		population += d.data.(*Point[city]).Data().Population
+	}
+	return population
+}
+
+func Test_Tree_Typed_Insert_Delete(t *testing.T) {
+	a := NewPoint("a", []float64{1, 1})
+	b := NewPoint("b", []float64{1, 1})
+	c := NewPoint("c", []float64{5, 5})
+	origin := NewPoint("", []float64{0, 0})
+	tree := Build([]*Point[string]{}, 0, nil)
+	if nearest, _ := NN(tree, origin, nil); nearest != nil || tree.size() != 0 {
+		t.Error(`want: an empty Tree`)
+	}
+
+	tree.Insert(a)
+	tree.Insert(b)
+	tree.Insert(c)
+	if tree.size() != 3 {
+		t.Error(`want: 3
+		got: `, tree.size())
+	}
+
+	// only the Point itself is deleted, not another at the same position
+	if !tree.Delete(b) || tree.Delete(b) {
+		t.Error(`want: b deleted exactly once`)
+	}
+	if got := KNN(tree, origin, 3, nil); len(got) != 2 || got[0] != a || got[1] != c {
+		t.Error(`want: [a c]
+		got: `, got)
+	}
+	if got := tree.Points(); len(got) != 2 {
+		t.Error(`want: 2
+		got: `, len(got))
+	}
+}
+
+func Test_Point_Typed_JSON(t *testing.T) {
+	p := NewPoint(city{"Oslo", 700000}, []float64{59.9, 10.7})
+	b, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Point[city]
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Data() != p.Data() || !got.EqualTo(p) {
+		t.Error(`want: `, p, `
+		got: `, &got)
+	}
+
+	var untyped Datapoint
+	if err := json.Unmarshal(b, &untyped); err != nil {
+		t.Fatal(err)
+	}
+	if m, ok := untyped.Data().(map[string]interface{}); !ok || m["Name"] != "Oslo" {
+		t.Error(`want: a generic JSON object
+		got: `, untyped.Data())
+	}
+
+	var missing Point[int]
+	if err := json.Unmarshal([]byte(`{"set":[1]}`), &missing); err != nil || missing.Data() != 0 {
+		t.Error(`want: zero data
+		got: `, missing.Data(), err)
+	}
+}